@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// contentTables are exported and imported in this order so rows are loaded
+// after the rows they reference. Submissions, uploads and keys are not content.
+var contentTables = []string{"blogs", "blog_images", "comments", "events", "books", "forms", "form_versions"}
+
+// ownerColumns reference admin users, who aren't exported. Import clears owners
+// that don't exist in the target database, leaving the free-text name.
+var ownerColumns = map[string]string{"blogs": "author_id", "events": "created_by_id", "books": "created_by_id"}
+
+// contentExport is the file format written by export and read by import
+type contentExport struct {
+	ExportedAt time.Time                  `json:"exported_at"`
+	Tables     map[string]json.RawMessage `json:"tables"`
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("out", "", "file to write, stdout by default")
+	fs.Parse(args)
+
+	db := openDB()
+	defer db.Close()
+	ctx := context.Background()
+
+	export := contentExport{ExportedAt: time.Now().UTC(), Tables: make(map[string]json.RawMessage)}
+	for _, table := range contentTables {
+		var rows json.RawMessage
+		err := db.QueryRow(
+			ctx,
+			"SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.id), '[]'::jsonb) FROM "+table+" t",
+		).Scan(&rows)
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %v", table, err)
+		}
+		export.Tables[table] = rows
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return fmt.Errorf("failed to write export: %v", err)
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "Exported content to %s\n", *out)
+	}
+	return nil
+}
+
+// runImport loads an export in one transaction. Rows whose ID already exists
+// are skipped, so importing the same file twice changes nothing.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("in", "", "file to read, stdin by default")
+	fs.Parse(args)
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	var export contentExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return fmt.Errorf("invalid export file: %v", err)
+	}
+
+	db := openDB()
+	defer db.Close()
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, table := range contentTables {
+		rows, ok := export.Tables[table]
+		if !ok {
+			continue
+		}
+		source := "$1::jsonb"
+		if column, ok := ownerColumns[table]; ok {
+			source = `(SELECT COALESCE(jsonb_agg(CASE
+				WHEN EXISTS(SELECT 1 FROM admin_users WHERE id = (r->>'` + column + `')::int) THEN r
+				ELSE r - '` + column + `' END), '[]'::jsonb)
+				FROM jsonb_array_elements($1::jsonb) r)`
+		}
+		result, err := tx.Exec(
+			ctx,
+			"INSERT INTO "+table+" SELECT * FROM jsonb_populate_recordset(NULL::"+table+", "+source+") ON CONFLICT (id) DO NOTHING",
+			rows,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %v", table, err)
+		}
+		if err := resetSequence(ctx, tx, table); err != nil {
+			return fmt.Errorf("failed to import %s: %v", table, err)
+		}
+		fmt.Printf("%s: %d imported\n", table, result.RowsAffected())
+	}
+
+	return tx.Commit(ctx)
+}
+
+// resetSequence moves a table's id sequence past the imported IDs
+func resetSequence(ctx context.Context, tx pgx.Tx, table string) error {
+	_, err := tx.Exec(
+		ctx,
+		"SELECT setval(pg_get_serial_sequence('"+table+"', 'id'), GREATEST(MAX(id), 1), MAX(id) IS NOT NULL) FROM "+table,
+	)
+	return err
+}
+
+// seedContent is sample content for a development database, one statement per table
+var seedContent = []struct {
+	table string
+	sql   string
+}{
+	{"blogs", `
+		INSERT INTO blogs (title, slug, content, author)
+		VALUES ('Welcome to Monk Reflections', 'welcome-to-monk-reflections',
+			'{"blocks": [{"type": "paragraph", "text": "A first post to try the blog with."}]}', 'Monk Reflections')`},
+	{"events", `
+		INSERT INTO events (title, description, event_type, status, start_date, end_date,
+			venue_name, is_virtual, timezone, capacity, organizer_name, organizer_email, is_public)
+		VALUES ('Morning Meditation', 'A guided sitting meditation for all levels.', 'meditation', 'published',
+			CURRENT_DATE + INTERVAL '7 days 7 hours', CURRENT_DATE + INTERVAL '7 days 8 hours',
+			'Main Hall', false, 'UTC', 30, 'Monk Reflections', 'events@example.com', true)`},
+	{"books", `
+		INSERT INTO books (title, author, description, category, price, stock_quantity, is_published)
+		VALUES ('Reflections on Stillness', 'Monk Reflections', 'Short essays on quiet and attention.',
+			'Spirituality', 12.99, 10, true)`},
+	{"forms", `
+		WITH form AS (
+			INSERT INTO forms (title, data, fields, is_published)
+			VALUES ('Contact', '{}',
+				'[{"name": "name", "label": "Name", "type": "text", "required": true},
+				  {"name": "email", "label": "Email", "type": "email", "required": true},
+				  {"name": "message", "label": "Message", "type": "text", "max_length": 2000}]',
+				true)
+			RETURNING id, title, fields, pages
+		)
+		INSERT INTO form_versions (form_id, version, title, fields, pages)
+		SELECT id, 1, title, fields, pages FROM form`},
+}
+
+// runSeed adds sample content to each content table that is still empty
+func runSeed() error {
+	db := openDB()
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, seed := range seedContent {
+		var empty bool
+		if err := db.QueryRow(ctx, "SELECT NOT EXISTS(SELECT 1 FROM "+seed.table+")").Scan(&empty); err != nil {
+			return fmt.Errorf("failed to check %s: %v", seed.table, err)
+		}
+		if !empty {
+			fmt.Printf("%s: already has content, skipped\n", seed.table)
+			continue
+		}
+		if _, err := db.Exec(ctx, seed.sql); err != nil {
+			return fmt.Errorf("failed to seed %s: %v", seed.table, err)
+		}
+		fmt.Printf("%s: seeded\n", seed.table)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// runHealth reports on the database and the optional integrations. It fails
+// only when the database is unusable.
+func runHealth() error {
+	db := openDB()
+	defer db.Close()
+	ctx := context.Background()
+
+	start := time.Now()
+	if err := db.Ping(ctx); err != nil {
+		return fmt.Errorf("database: %v", err)
+	}
+	fmt.Printf("database: ok (%s)\n", time.Since(start).Round(time.Millisecond))
+
+	var hasTables bool
+	err := db.QueryRow(ctx, "SELECT to_regclass('public.api_keys') IS NOT NULL").Scan(&hasTables)
+	if err != nil {
+		return fmt.Errorf("database: %v", err)
+	}
+	if !hasTables {
+		return errors.New("database: tables missing, run migrate")
+	}
+
+	if err := reportCounts(ctx, db); err != nil {
+		return err
+	}
+
+	if _, err := services.NewStorage(); err != nil {
+		fmt.Printf("storage: not configured (%v)\n", err)
+	} else {
+		fmt.Printf("storage: %s\n", services.StorageDriver())
+	}
+	if _, err := services.NewMailer(); err != nil {
+		fmt.Printf("mailer: not configured (%v)\n", err)
+	} else {
+		fmt.Println("mailer: configured")
+	}
+	return nil
+}
+
+func reportCounts(ctx context.Context, db *pgxpool.Pool) error {
+	checks := []struct {
+		label string
+		query string
+	}{
+		{"email outbox pending", "SELECT COUNT(*) FROM email_outbox WHERE status = 'pending'"},
+		{"email outbox failed", "SELECT COUNT(*) FROM email_outbox WHERE status = 'failed'"},
+		{"comments awaiting moderation", "SELECT COUNT(*) FROM comments WHERE status = 'pending' AND email_verified"},
+		{"active API keys", `SELECT COUNT(*) FROM api_keys WHERE revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'))`},
+	}
+	for _, check := range checks {
+		var count int
+		if err := db.QueryRow(ctx, check.query).Scan(&count); err != nil {
+			return fmt.Errorf("%s: %v", check.label, err)
+		}
+		fmt.Printf("%s: %d\n", check.label, count)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aslotsu/monkreflections-form-api/services"
+)
+
+// defaultRotationGrace matches the grace period of the API's rotate endpoint
+const defaultRotationGrace = 24 * time.Hour
+
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		return errors.New("keys needs a subcommand: create, list, revoke or rotate")
+	}
+
+	db := openDB()
+	defer db.Close()
+	store := services.NewAPIKeyStore(db)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("keys create", flag.ExitOnError)
+		name := fs.String("name", "", "name identifying the key")
+		scopes := fs.String("scopes", "", "comma-separated scopes, e.g. comments:moderate,blogs:write")
+		expires := fs.String("expires", "", "expiry date (YYYY-MM-DD or RFC3339), never by default")
+		fs.Parse(args[1:])
+
+		if *name == "" {
+			return errors.New("--name is required")
+		}
+		expiresAt, err := parseExpiry(*expires)
+		if err != nil {
+			return err
+		}
+
+		secret, key, err := store.Create(ctx, *name, splitList(*scopes), expiresAt)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created key %d (%s) with scopes %s\n", key.ID, key.KeyPrefix, strings.Join(key.Scopes, ", "))
+		fmt.Printf("API Key: %s\n", secret)
+		fmt.Println("Copy this key now, it can't be shown again.")
+		return nil
+
+	case "list":
+		keys, err := store.List(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tPREFIX\tNAME\tSCOPES\tSTATUS\tEXPIRES\tLAST USED")
+		for _, key := range keys {
+			status := "active"
+			switch {
+			case key.RevokedAt != nil:
+				status = "revoked"
+			case key.ExpiresAt != nil && !time.Now().Before(*key.ExpiresAt):
+				status = "expired"
+			case key.ReplacedBy != nil:
+				status = "rotated to " + strconv.Itoa(*key.ReplacedBy)
+			}
+			lastUsed := "never"
+			if key.LastUsedAt != nil {
+				lastUsed = formatTime(key.LastUsedAt) + " from " + key.LastUsedIP
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				key.ID, key.KeyPrefix, key.Name, strings.Join(key.Scopes, ","), status, formatTime(key.ExpiresAt), lastUsed)
+		}
+		return w.Flush()
+
+	case "revoke":
+		id, err := keyID(args[1:])
+		if err != nil {
+			return err
+		}
+		if err := store.Revoke(ctx, id); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked key %d\n", id)
+		return nil
+
+	case "rotate":
+		id, err := keyID(args[1:])
+		if err != nil {
+			return err
+		}
+		fs := flag.NewFlagSet("keys rotate", flag.ExitOnError)
+		grace := fs.Duration("grace", defaultRotationGrace, "how long the old key keeps working")
+		expires := fs.String("expires", "", "expiry date of the new key (YYYY-MM-DD or RFC3339)")
+		fs.Parse(args[2:])
+
+		expiresAt, err := parseExpiry(*expires)
+		if err != nil {
+			return err
+		}
+		secret, key, oldExpiresAt, err := store.Rotate(ctx, id, *grace, expiresAt)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Key %d replaced by key %d (%s); the old key works until %s\n",
+			id, key.ID, key.KeyPrefix, oldExpiresAt.Format(time.RFC3339))
+		fmt.Printf("API Key: %s\n", secret)
+		fmt.Println("Copy this key now, it can't be shown again.")
+		return nil
+	}
+
+	return fmt.Errorf("unknown keys subcommand %q", args[0])
+}
+
+func keyID(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, errors.New("a key ID is required")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid key ID %q", args[0])
+	}
+	return id, nil
+}
+
+// parseExpiry accepts YYYY-MM-DD (midnight UTC) or RFC3339; empty means no expiry
+func parseExpiry(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q: use YYYY-MM-DD or RFC3339", value)
+	}
+	if !t.After(time.Now()) {
+		return nil, errors.New("expiry must be in the future")
+	}
+	return &t, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
@@ -0,0 +1,95 @@
+// Command admin is the operational tool for the API. It reads the same
+// environment (.env, DATABASE_URL) as the server and uses the same database code.
+//
+//	go run ./cmd/admin <command> [arguments]
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/aslotsu/monkreflections-form-api/config"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const usage = `Usage: admin <command> [arguments]
+
+Commands:
+  keys create --name NAME --scopes SCOPE[,SCOPE] [--expires DATE]
+  keys list
+  keys revoke ID
+  keys rotate ID [--grace DURATION] [--expires DATE]
+  users create --email EMAIL --name NAME [--role editor|author]   (password read from stdin)
+  users list
+  users set-role ID editor|author
+  users set-password|reset-totp|disable|enable ID
+  migrate                          create tables and run migrations
+  seed                             add sample content to empty tables
+  export [--out FILE]              write content as JSON (stdout by default)
+  import [--in FILE]               load content written by export (stdin by default)
+  moderate queue
+  moderate approve|reject|spam|delete [--note NOTE] ID...
+  health                           check the database, outbox and integrations
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	config.LoadEnv()
+
+	command, args := os.Args[1], os.Args[2:]
+	var err error
+	switch command {
+	case "keys":
+		err = runKeys(args)
+	case "users":
+		err = runUsers(args)
+	case "migrate":
+		err = runMigrate()
+	case "seed":
+		err = runSeed()
+	case "export":
+		err = runExport(args)
+	case "import":
+		err = runImport(args)
+	case "moderate":
+		err = runModerate(args)
+	case "health":
+		err = runHealth()
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// openDB connects without running migrations; only migrate changes the schema
+func openDB() *pgxpool.Pool {
+	return config.OpenDBFromURL(config.DatabaseURL())
+}
+
+func runMigrate() error {
+	db := config.ConnectDBFromURL(config.DatabaseURL())
+	defer db.Close()
+	fmt.Println("Migrations complete")
+	return nil
+}
+
+// operator names the person running the CLI in moderation records
+func operator() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "admin CLI (" + u.Username + ")"
+	}
+	return "admin CLI"
+}
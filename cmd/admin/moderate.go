@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aslotsu/monkreflections-form-api/handlers"
+	"github.com/aslotsu/monkreflections-form-api/models"
+)
+
+var moderationActions = []string{
+	models.ModerationActionApprove,
+	models.ModerationActionReject,
+	models.ModerationActionSpam,
+	models.ModerationActionDelete,
+}
+
+func runModerate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("moderate needs a subcommand: queue, approve, reject, spam or delete")
+	}
+
+	db := openDB()
+	defer db.Close()
+	ctx := context.Background()
+
+	if args[0] == "queue" {
+		rows, err := db.Query(ctx, `
+			SELECT c.id, c.blog_id, COALESCE(b.title, ''), c.author_name, c.author_email, c.content, c.created_at
+			FROM comments c
+			JOIN blogs b ON b.id = c.blog_id
+			WHERE c.status = 'pending' AND c.email_verified
+			ORDER BY c.created_at ASC
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to fetch moderation queue: %v", err)
+		}
+		defer rows.Close()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tBLOG\tAUTHOR\tSUBMITTED\tCOMMENT")
+		count := 0
+		for rows.Next() {
+			var comment models.Comment
+			var blogTitle string
+			if err := rows.Scan(
+				&comment.ID, &comment.BlogID, &blogTitle, &comment.AuthorName,
+				&comment.AuthorEmail, &comment.Content, &comment.CreatedAt,
+			); err != nil {
+				return fmt.Errorf("failed to scan comment: %v", err)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s <%s>\t%s\t%s\n",
+				comment.ID, blogTitle, comment.AuthorName, comment.AuthorEmail,
+				formatTime(&comment.CreatedAt), preview(comment.Content, 60))
+			count++
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("%d pending comments\n", count)
+		return nil
+	}
+
+	action := args[0]
+	if !slices.Contains(moderationActions, action) {
+		return fmt.Errorf("unknown moderate subcommand %q", action)
+	}
+	fs := flag.NewFlagSet("moderate "+action, flag.ExitOnError)
+	note := fs.String("note", "", "note recorded with the decision")
+	fs.Parse(args[1:])
+
+	var ids []int
+	for _, arg := range fs.Args() {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid comment ID %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return errors.New("at least one comment ID is required")
+	}
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	missing, err := handlers.ModerateComments(ctx, db, ids, action, *note, models.AuditActor{Name: operator(), Type: models.ActorTypeCLI})
+	if err != nil {
+		return fmt.Errorf("failed to moderate comments: %v", err)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("comments not found, nothing was changed: %v", missing)
+	}
+	fmt.Printf("%d comments: %s\n", len(ids), action)
+	return nil
+}
+
+// preview shortens text to one line of at most n characters
+func preview(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return text
+}
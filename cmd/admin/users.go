@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func runUsers(args []string) error {
+	if len(args) == 0 {
+		return errors.New("users needs a subcommand: create, list, set-role, set-password, reset-totp, disable or enable")
+	}
+
+	db := openDB()
+	defer db.Close()
+	ctx := context.Background()
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("users create", flag.ExitOnError)
+		email := fs.String("email", "", "login email address")
+		name := fs.String("name", "", "display name")
+		role := fs.String("role", models.RoleEditor, "editor or author")
+		fs.Parse(args[1:])
+
+		if *email == "" || *name == "" {
+			return errors.New("--email and --name are required")
+		}
+		if _, ok := models.RoleScopes[*role]; !ok {
+			return fmt.Errorf("unknown role %q, use editor or author", *role)
+		}
+		slug, err := uniqueSlug(ctx, db, *name)
+		if err != nil {
+			return err
+		}
+		hash, err := readPasswordHash()
+		if err != nil {
+			return err
+		}
+
+		var id int
+		err = db.QueryRow(
+			ctx,
+			"INSERT INTO admin_users (email, name, password_hash, role, slug) VALUES (LOWER($1), $2, $3, $4, $5) RETURNING id",
+			strings.TrimSpace(*email), *name, hash, *role, slug,
+		).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to create user: %v", err)
+		}
+		fmt.Printf("Created %s %d (%s), profile /api/authors/%s\n", *role, id, *email, slug)
+		return nil
+
+	case "list":
+		rows, err := db.Query(ctx, `
+			SELECT id, email, name, role, totp_enabled, disabled_at IS NOT NULL, last_login_at
+			FROM admin_users ORDER BY id
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to list users: %v", err)
+		}
+		defer rows.Close()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tEMAIL\tNAME\tROLE\t2FA\tSTATUS\tLAST LOGIN")
+		for rows.Next() {
+			var id int
+			var email, name, role string
+			var totp, disabled bool
+			var lastLogin *time.Time
+			if err := rows.Scan(&id, &email, &name, &role, &totp, &disabled, &lastLogin); err != nil {
+				return fmt.Errorf("failed to scan user: %v", err)
+			}
+			status := "active"
+			if disabled {
+				status = "disabled"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%t\t%s\t%s\n", id, email, name, role, totp, status, formatTime(lastLogin))
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return w.Flush()
+
+	case "set-password":
+		id, err := userID(args[1:])
+		if err != nil {
+			return err
+		}
+		hash, err := readPasswordHash()
+		if err != nil {
+			return err
+		}
+		// Changing the password signs the user out everywhere
+		return updateUser(ctx, db, id, "password reset; sessions ended",
+			"UPDATE admin_users SET password_hash = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1", hash)
+
+	case "set-role":
+		id, err := userID(args[1:])
+		if err != nil {
+			return err
+		}
+		if len(args) < 3 {
+			return errors.New("usage: users set-role ID editor|author")
+		}
+		role := args[2]
+		if _, ok := models.RoleScopes[role]; !ok {
+			return fmt.Errorf("unknown role %q, use editor or author", role)
+		}
+		return updateUser(ctx, db, id, "is now an "+role+"; sessions ended",
+			"UPDATE admin_users SET role = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1", role)
+
+	case "reset-totp":
+		id, err := userID(args[1:])
+		if err != nil {
+			return err
+		}
+		return updateUser(ctx, db, id, "two-factor authentication removed",
+			"UPDATE admin_users SET totp_enabled = false, totp_secret = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1")
+
+	case "disable":
+		id, err := userID(args[1:])
+		if err != nil {
+			return err
+		}
+		return updateUser(ctx, db, id, "disabled; sessions ended",
+			"UPDATE admin_users SET disabled_at = (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'), updated_at = CURRENT_TIMESTAMP WHERE id = $1")
+
+	case "enable":
+		id, err := userID(args[1:])
+		if err != nil {
+			return err
+		}
+		return updateUser(ctx, db, id, "enabled",
+			"UPDATE admin_users SET disabled_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1")
+	}
+
+	return fmt.Errorf("unknown users subcommand %q", args[0])
+}
+
+// updateUser runs an update on one user and ends their sessions
+func updateUser(ctx context.Context, db *pgxpool.Pool, id int, done, query string, args ...any) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, query, append([]any{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user %d not found", id)
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM admin_sessions WHERE user_id = $1", id); err != nil {
+		return fmt.Errorf("failed to end sessions: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	fmt.Printf("User %d %s\n", id, done)
+	return nil
+}
+
+// readPasswordHash reads a password from the first line of stdin, so it can be
+// piped in rather than appearing in the shell history
+func readPasswordHash() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("no password given on stdin")
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if len(password) < services.MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", services.MinPasswordLength)
+	}
+	return services.HashPassword(password)
+}
+
+func userID(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, errors.New("a user ID is required")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID %q", args[0])
+	}
+	return id, nil
+}
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// uniqueSlug makes the public profile handle for a new user from their name,
+// adding a number if it's taken
+func uniqueSlug(ctx context.Context, db *pgxpool.Pool, name string) (string, error) {
+	base := strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if base == "" {
+		base = "author"
+	}
+	slug := base
+	for n := 2; ; n++ {
+		var taken bool
+		if err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM admin_users WHERE slug = $1)", slug).Scan(&taken); err != nil {
+			return "", fmt.Errorf("failed to check slug: %v", err)
+		}
+		if !taken {
+			return slug, nil
+		}
+		slug = base + "-" + strconv.Itoa(n)
+	}
+}
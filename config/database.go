@@ -5,9 +5,20 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// DB is the part of *pgxpool.Pool that handlers and middleware use, so routes
+// can be exercised against a stand-in database in tests
+type DB interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type DBConfig struct {
 	Host     string
 	Port     string
@@ -48,6 +59,16 @@ func ConnectDB(config *DBConfig) *pgxpool.Pool {
 }
 
 func ConnectDBFromURL(dsn string) *pgxpool.Pool {
+	pool := OpenDBFromURL(dsn)
+
+	// Create tables
+	CreateTables(pool)
+
+	return pool
+}
+
+// OpenDBFromURL connects to the database without running migrations
+func OpenDBFromURL(dsn string) *pgxpool.Pool {
 	pool, err := pgxpool.New(context.Background(), dsn)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
@@ -59,9 +80,6 @@ func ConnectDBFromURL(dsn string) *pgxpool.Pool {
 		log.Fatalf("Failed to ping database: %v", err)
 	}
 
-	// Create tables
-	CreateTables(pool)
-
 	return pool
 }
 
@@ -202,11 +220,154 @@ func CreateTables(pool *pgxpool.Pool) {
 		);
 	`
 
+	createFormSubmissionsTableSQL := `
+		CREATE TABLE IF NOT EXISTS form_submissions (
+			id SERIAL PRIMARY KEY,
+			form_id INTEGER NOT NULL REFERENCES forms(id) ON DELETE CASCADE,
+			data JSONB NOT NULL,
+			ip_address VARCHAR(100),
+			user_agent VARCHAR(500),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+	`
+
+	createFormVersionsTableSQL := `
+		CREATE TABLE IF NOT EXISTS form_versions (
+			id SERIAL PRIMARY KEY,
+			form_id INTEGER NOT NULL REFERENCES forms(id) ON DELETE CASCADE,
+			version INTEGER NOT NULL,
+			title VARCHAR(255) NOT NULL,
+			fields JSONB NOT NULL,
+			pages JSONB NOT NULL DEFAULT '[]',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (form_id, version)
+		);
+	`
+
+	createFormUploadsTableSQL := `
+		CREATE TABLE IF NOT EXISTS form_uploads (
+			id UUID PRIMARY KEY,
+			form_id INTEGER NOT NULL REFERENCES forms(id) ON DELETE CASCADE,
+			submission_id INTEGER REFERENCES form_submissions(id) ON DELETE CASCADE,
+			field_name VARCHAR(255) NOT NULL,
+			object_key VARCHAR(500) NOT NULL,
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(255) NOT NULL,
+			size_bytes BIGINT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+	`
+
+	createEmailOutboxTableSQL := `
+		CREATE TABLE IF NOT EXISTS email_outbox (
+			id SERIAL PRIMARY KEY,
+			to_address VARCHAR(255) NOT NULL,
+			subject VARCHAR(500) NOT NULL,
+			body TEXT NOT NULL,
+			status VARCHAR(50) NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT,
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			sent_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_email_outbox_pending ON email_outbox (next_attempt_at) WHERE status = 'pending';
+	`
+
 	_, err := pool.Exec(context.Background(), createFormTableSQL)
 	if err != nil {
 		log.Fatalf("Failed to create forms table: %v", err)
 	}
 
+	// Migration: Add field schema column to forms table if it doesn't exist
+	addFormFieldsColumnSQL := `
+		ALTER TABLE forms ADD COLUMN IF NOT EXISTS fields JSONB NOT NULL DEFAULT '[]';
+	`
+	_, err = pool.Exec(context.Background(), addFormFieldsColumnSQL)
+	if err != nil {
+		log.Fatalf("Failed to add fields column to forms table: %v", err)
+	}
+
+	// Migration: Add pages column for multi-step forms
+	addFormPagesColumnSQL := `
+		ALTER TABLE forms ADD COLUMN IF NOT EXISTS pages JSONB NOT NULL DEFAULT '[]';
+	`
+	_, err = pool.Exec(context.Background(), addFormPagesColumnSQL)
+	if err != nil {
+		log.Fatalf("Failed to add pages column to forms table: %v", err)
+	}
+
+	// Migration: Forms are only visible to the public once published
+	addFormPublishedColumnSQL := `
+		ALTER TABLE forms ADD COLUMN IF NOT EXISTS is_published BOOLEAN NOT NULL DEFAULT false;
+	`
+	_, err = pool.Exec(context.Background(), addFormPublishedColumnSQL)
+	if err != nil {
+		log.Fatalf("Failed to add is_published column to forms table: %v", err)
+	}
+
+	// Migration: Add scheduling and response cap columns to forms table
+	addFormLifecycleColumnsSQL := `
+		ALTER TABLE forms ADD COLUMN IF NOT EXISTS opens_at TIMESTAMP;
+		ALTER TABLE forms ADD COLUMN IF NOT EXISTS closes_at TIMESTAMP;
+		ALTER TABLE forms ADD COLUMN IF NOT EXISTS max_responses INTEGER;
+		ALTER TABLE forms ADD COLUMN IF NOT EXISTS closed_message TEXT;
+		ALTER TABLE forms ADD COLUMN IF NOT EXISTS current_version INTEGER NOT NULL DEFAULT 1;
+	`
+	_, err = pool.Exec(context.Background(), addFormLifecycleColumnsSQL)
+	if err != nil {
+		log.Fatalf("Failed to add lifecycle columns to forms table: %v", err)
+	}
+
+	_, err = pool.Exec(context.Background(), createFormVersionsTableSQL)
+	if err != nil {
+		log.Fatalf("Failed to create form_versions table: %v", err)
+	}
+
+	// Migration: Record the existing schema of every form as its first version
+	backfillFormVersionsSQL := `
+		INSERT INTO form_versions (form_id, version, title, fields, pages)
+		SELECT f.id, f.current_version, f.title, f.fields, f.pages FROM forms f
+		WHERE NOT EXISTS (SELECT 1 FROM form_versions v WHERE v.form_id = f.id);
+	`
+	_, err = pool.Exec(context.Background(), backfillFormVersionsSQL)
+	if err != nil {
+		log.Fatalf("Failed to backfill form_versions: %v", err)
+	}
+
+	_, err = pool.Exec(context.Background(), createFormSubmissionsTableSQL)
+	if err != nil {
+		log.Fatalf("Failed to create form_submissions table: %v", err)
+	}
+
+	// Migration: Add per-form notification settings
+	addFormNotificationsColumnSQL := `
+		ALTER TABLE forms ADD COLUMN IF NOT EXISTS notifications JSONB NOT NULL DEFAULT '{}';
+	`
+	_, err = pool.Exec(context.Background(), addFormNotificationsColumnSQL)
+	if err != nil {
+		log.Fatalf("Failed to add notifications column to forms table: %v", err)
+	}
+
+	// Migration: Submissions reference the schema version they were validated against
+	addSubmissionVersionColumnSQL := `
+		ALTER TABLE form_submissions ADD COLUMN IF NOT EXISTS form_version INTEGER NOT NULL DEFAULT 1;
+	`
+	_, err = pool.Exec(context.Background(), addSubmissionVersionColumnSQL)
+	if err != nil {
+		log.Fatalf("Failed to add form_version column to form_submissions table: %v", err)
+	}
+
+	_, err = pool.Exec(context.Background(), createFormUploadsTableSQL)
+	if err != nil {
+		log.Fatalf("Failed to create form_uploads table: %v", err)
+	}
+
+	_, err = pool.Exec(context.Background(), createEmailOutboxTableSQL)
+	if err != nil {
+		log.Fatalf("Failed to create email_outbox table: %v", err)
+	}
+
 	_, err = pool.Exec(context.Background(), createBlogsTableSQL)
 	if err != nil {
 		log.Fatalf("Failed to create blogs table: %v", err)
@@ -237,6 +398,16 @@ func CreateTables(pool *pgxpool.Pool) {
 		log.Fatalf("Failed to create comments table: %v", err)
 	}
 
+	// Migration: Record the spam filter's score on each comment
+	addCommentSpamColumnsSQL := `
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS spam_score DOUBLE PRECISION NOT NULL DEFAULT 0;
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS spam_reasons JSONB NOT NULL DEFAULT '[]';
+	`
+	_, err = pool.Exec(context.Background(), addCommentSpamColumnsSQL)
+	if err != nil {
+		log.Fatalf("Failed to add spam columns to comments table: %v", err)
+	}
+
 	// Migration: Add slug column to blogs table if it doesn't exist
 	addSlugColumnSQL := `
 		ALTER TABLE blogs ADD COLUMN IF NOT EXISTS slug VARCHAR(255);
@@ -245,4 +416,363 @@ func CreateTables(pool *pgxpool.Pool) {
 	if err != nil {
 		log.Fatalf("Failed to add slug column to blogs table: %v", err)
 	}
+
+	// Migration: Record who moderated each comment
+	addCommentModerationColumnsSQL := `
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS moderated_by VARCHAR(255);
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS moderated_at TIMESTAMP;
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS moderation_note TEXT;
+		CREATE TABLE IF NOT EXISTS comment_moderations (
+			id SERIAL PRIMARY KEY,
+			comment_id INTEGER NOT NULL,
+			action VARCHAR(50) NOT NULL,
+			note TEXT,
+			moderator VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_comment_moderations_comment_id ON comment_moderations (comment_id);
+	`
+	_, err = pool.Exec(context.Background(), addCommentModerationColumnsSQL)
+	if err != nil {
+		log.Fatalf("Failed to add comment moderation columns: %v", err)
+	}
+
+	// Migration: Commenter email verification and edits by the commenter.
+	// Existing comments predate verification and count as verified.
+	addCommentOwnershipSQL := `
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT true;
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP;
+		CREATE TABLE IF NOT EXISTS verified_commenters (
+			email VARCHAR(255) PRIMARY KEY,
+			verified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS comment_edits (
+			id SERIAL PRIMARY KEY,
+			comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+			previous_content TEXT NOT NULL,
+			edited_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+	`
+	_, err = pool.Exec(context.Background(), addCommentOwnershipSQL)
+	if err != nil {
+		log.Fatalf("Failed to add comment ownership columns: %v", err)
+	}
+
+	// Migration: Blogs no longer copy their author's email; the comment author
+	// badge comes from the author's login session instead
+	dropBlogAuthorEmailColumnSQL := `
+		ALTER TABLE blogs DROP COLUMN IF EXISTS author_email;
+	`
+	_, err = pool.Exec(context.Background(), dropBlogAuthorEmailColumnSQL)
+	if err != nil {
+		log.Fatalf("Failed to drop author_email column from blogs table: %v", err)
+	}
+
+	// Migration: Comments must belong to an existing blog
+	linkCommentsToBlogs(pool)
+
+	// Migration: Per-blog comment settings. NULL close-after and max depth mean no limit.
+	addBlogCommentSettingsSQL := `
+		ALTER TABLE blogs ADD COLUMN IF NOT EXISTS comments_enabled BOOLEAN NOT NULL DEFAULT true;
+		ALTER TABLE blogs ADD COLUMN IF NOT EXISTS comments_close_after_days INTEGER;
+		ALTER TABLE blogs ADD COLUMN IF NOT EXISTS comments_auto_approve BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE blogs ADD COLUMN IF NOT EXISTS comments_max_depth INTEGER;
+	`
+	_, err = pool.Exec(context.Background(), addBlogCommentSettingsSQL)
+	if err != nil {
+		log.Fatalf("Failed to add comment settings to blogs table: %v", err)
+	}
+
+	// Migration: API key scopes. Keys that predate scopes keep full access.
+	addApiKeyScopesSQL := `
+		ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS scopes TEXT[];
+		UPDATE api_keys SET scopes = ARRAY['*'] WHERE scopes IS NULL;
+		ALTER TABLE api_keys ALTER COLUMN scopes SET DEFAULT '{}';
+		ALTER TABLE api_keys ALTER COLUMN scopes SET NOT NULL;
+	`
+	_, err = pool.Exec(context.Background(), addApiKeyScopesSQL)
+	if err != nil {
+		log.Fatalf("Failed to add scopes column to api_keys table: %v", err)
+	}
+
+	// Migration: API key lifecycle. Times are stored in UTC.
+	addApiKeyLifecycleSQL := `
+		ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS key_prefix VARCHAR(16);
+		ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+		ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP;
+		ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP;
+		ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS last_used_ip VARCHAR(64);
+		ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS replaced_by INTEGER REFERENCES api_keys(id) ON DELETE SET NULL;
+	`
+	_, err = pool.Exec(context.Background(), addApiKeyLifecycleSQL)
+	if err != nil {
+		log.Fatalf("Failed to add lifecycle columns to api_keys table: %v", err)
+	}
+
+	// Migration: Admin user accounts and login sessions
+	createAdminUsersSQL := `
+		CREATE TABLE IF NOT EXISTS admin_users (
+			id SERIAL PRIMARY KEY,
+			email VARCHAR(255) UNIQUE NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			password_hash TEXT NOT NULL,
+			totp_secret VARCHAR(64),
+			totp_enabled BOOLEAN NOT NULL DEFAULT false,
+			totp_last_step BIGINT NOT NULL DEFAULT 0,
+			disabled_at TIMESTAMP,
+			last_login_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS admin_sessions (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES admin_users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			csrf_token VARCHAR(64) NOT NULL,
+			ip_address VARCHAR(100),
+			user_agent VARCHAR(500),
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_admin_sessions_user_id ON admin_sessions (user_id);
+	`
+	_, err = pool.Exec(context.Background(), createAdminUsersSQL)
+	if err != nil {
+		log.Fatalf("Failed to create admin user tables: %v", err)
+	}
+
+	// Migration: Roles and public profiles for admin users, and content
+	// ownership. Existing users become editors. Existing content is linked to
+	// a user only where its free-text author names exactly one user.
+	addContentOwnershipSQL := `
+		ALTER TABLE admin_users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'editor'
+			CHECK (role IN ('editor', 'author'));
+		ALTER TABLE admin_users ADD COLUMN IF NOT EXISTS slug VARCHAR(255) UNIQUE;
+		ALTER TABLE admin_users ADD COLUMN IF NOT EXISTS bio TEXT;
+		UPDATE admin_users u
+		SET slug = s.base || CASE WHEN s.taken > 1 THEN '-' || u.id ELSE '' END
+		FROM (
+			SELECT id, base, COUNT(*) OVER (PARTITION BY base) AS taken
+			FROM (
+				SELECT id, COALESCE(NULLIF(TRIM(BOTH '-' FROM regexp_replace(LOWER(name), '[^a-z0-9]+', '-', 'g')), ''), 'author') AS base
+				FROM admin_users WHERE slug IS NULL
+			) bases
+		) s
+		WHERE u.id = s.id;
+		ALTER TABLE admin_users ALTER COLUMN slug SET NOT NULL;
+
+		ALTER TABLE blogs ADD COLUMN IF NOT EXISTS author_id INTEGER REFERENCES admin_users(id) ON DELETE SET NULL;
+		ALTER TABLE events ADD COLUMN IF NOT EXISTS created_by_id INTEGER REFERENCES admin_users(id) ON DELETE SET NULL;
+		ALTER TABLE books ADD COLUMN IF NOT EXISTS created_by_id INTEGER REFERENCES admin_users(id) ON DELETE SET NULL;
+		CREATE INDEX IF NOT EXISTS idx_blogs_author_id ON blogs (author_id);
+		CREATE INDEX IF NOT EXISTS idx_events_created_by_id ON events (created_by_id);
+
+		UPDATE blogs b SET author_id = u.id
+		FROM admin_users u
+		WHERE b.author_id IS NULL AND LOWER(b.author) = LOWER(u.name)
+			AND (SELECT COUNT(*) FROM admin_users WHERE LOWER(name) = LOWER(b.author)) = 1;
+		UPDATE events e SET created_by_id = u.id
+		FROM admin_users u
+		WHERE e.created_by_id IS NULL AND LOWER(e.created_by) = LOWER(u.name)
+			AND (SELECT COUNT(*) FROM admin_users WHERE LOWER(name) = LOWER(e.created_by)) = 1;
+		UPDATE books bk SET created_by_id = u.id
+		FROM admin_users u
+		WHERE bk.created_by_id IS NULL AND LOWER(bk.created_by) = LOWER(u.name)
+			AND (SELECT COUNT(*) FROM admin_users WHERE LOWER(name) = LOWER(bk.created_by)) = 1;
+	`
+	_, err = pool.Exec(context.Background(), addContentOwnershipSQL)
+	if err != nil {
+		log.Fatalf("Failed to add content ownership columns: %v", err)
+	}
+
+	// Migration: Audit log of admin changes. Entries outlive the actor and the
+	// resource, so nothing here is a foreign key.
+	createAuditLogSQL := `
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			actor VARCHAR(255) NOT NULL,
+			actor_type VARCHAR(20) NOT NULL,
+			actor_id INTEGER,
+			action VARCHAR(20) NOT NULL,
+			resource_type VARCHAR(50) NOT NULL,
+			resource_id INTEGER NOT NULL,
+			before JSONB,
+			after JSONB,
+			ip_address VARCHAR(64),
+			request_id VARCHAR(100),
+			created_at TIMESTAMP NOT NULL DEFAULT (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON audit_log (resource_type, resource_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor_type, actor_id);
+	`
+	_, err = pool.Exec(context.Background(), createAuditLogSQL)
+	if err != nil {
+		log.Fatalf("Failed to create audit_log table: %v", err)
+	}
+
+	// Migration: Token buckets for RATE_LIMIT_STORE=postgres. Buckets past
+	// full_at have refilled and can be deleted.
+	createRateLimitBucketsSQL := `
+		CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+			key VARCHAR(255) PRIMARY KEY,
+			tokens DOUBLE PRECISION NOT NULL,
+			allowed BOOLEAN NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			full_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_full_at ON rate_limit_buckets (full_at);
+	`
+	_, err = pool.Exec(context.Background(), createRateLimitBucketsSQL)
+	if err != nil {
+		log.Fatalf("Failed to create rate_limit_buckets table: %v", err)
+	}
+
+	// Responsive variants. Width and height stay NULL on images uploaded before
+	// they were recorded.
+	addBlogImageVariantsSQL := `
+		ALTER TABLE blog_images ADD COLUMN IF NOT EXISTS width INTEGER;
+		ALTER TABLE blog_images ADD COLUMN IF NOT EXISTS height INTEGER;
+		ALTER TABLE blog_images ADD COLUMN IF NOT EXISTS webp_key VARCHAR(500);
+		ALTER TABLE blog_images ADD COLUMN IF NOT EXISTS webp_url VARCHAR(1000);
+		ALTER TABLE blog_images ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]';
+		CREATE INDEX IF NOT EXISTS idx_blog_images_blog_id ON blog_images (blog_id);
+	`
+	_, err = pool.Exec(context.Background(), addBlogImageVariantsSQL)
+	if err != nil {
+		log.Fatalf("Failed to add blog image variants: %v", err)
+	}
+
+	// Blog images uploaded straight to storage, awaiting completion. Rows
+	// outlive their blog so cleanup can still remove the uploaded file.
+	createBlogImageUploadsSQL := `
+		CREATE TABLE IF NOT EXISTS blog_image_uploads (
+			id UUID PRIMARY KEY,
+			blog_id INTEGER REFERENCES blogs(id) ON DELETE SET NULL,
+			object_key VARCHAR(500) NOT NULL,
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(255) NOT NULL,
+			size_bytes BIGINT NOT NULL,
+			alt_text VARCHAR(500),
+			created_at TIMESTAMP NOT NULL DEFAULT (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'),
+			expires_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_blog_image_uploads_expires_at ON blog_image_uploads (expires_at);
+	`
+	_, err = pool.Exec(context.Background(), createBlogImageUploadsSQL)
+	if err != nil {
+		log.Fatalf("Failed to create blog_image_uploads table: %v", err)
+	}
+
+	// Comments deleted by their commenter while they have replies keep their row,
+	// emptied, so the replies stay in place
+	addCommentDeletedAtSQL := `
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+	`
+	_, err = pool.Exec(context.Background(), addCommentDeletedAtSQL)
+	if err != nil {
+		log.Fatalf("Failed to add deleted_at column to comments table: %v", err)
+	}
+
+	// The author badge is set when the blog's author posts while logged in,
+	// rather than worked out from the commenter's email, which anyone can type
+	addCommentIsAuthorSQL := `
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS is_author BOOLEAN NOT NULL DEFAULT false;
+	`
+	_, err = pool.Exec(context.Background(), addCommentIsAuthorSQL)
+	if err != nil {
+		log.Fatalf("Failed to add is_author column to comments table: %v", err)
+	}
+
+	// Migration: Remove contact details recorded in audit snapshots before
+	// they were left out of comment and event snapshots
+	scrubAuditContactDetailsSQL := `
+		UPDATE audit_log SET before = before - '{author_email,ip_address}'::text[], after = after - '{author_email,ip_address}'::text[]
+		WHERE resource_type = 'comment' AND (before ?| '{author_email,ip_address}' OR after ?| '{author_email,ip_address}');
+		UPDATE audit_log SET before = before - '{organizer_email,organizer_phone}'::text[], after = after - '{organizer_email,organizer_phone}'::text[]
+		WHERE resource_type = 'event' AND (before ?| '{organizer_email,organizer_phone}' OR after ?| '{organizer_email,organizer_phone}');
+	`
+	_, err = pool.Exec(context.Background(), scrubAuditContactDetailsSQL)
+	if err != nil {
+		log.Fatalf("Failed to remove contact details from audit_log: %v", err)
+	}
+}
+
+// linkCommentsToBlogs moves comments whose blog no longer exists into
+// orphaned_comments, then adds the foreign key from comments to blogs.
+// Blog slugs are refreshed on the remaining comments.
+func linkCommentsToBlogs(pool *pgxpool.Pool) {
+	ctx := context.Background()
+
+	var hasForeignKey bool
+	err := pool.QueryRow(
+		ctx,
+		"SELECT EXISTS(SELECT 1 FROM pg_constraint WHERE conname = 'comments_blog_id_fkey')",
+	).Scan(&hasForeignKey)
+	if err != nil {
+		log.Fatalf("Failed to check comments foreign key: %v", err)
+	}
+	if hasForeignKey {
+		return
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		log.Fatalf("Failed to link comments to blogs: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Orphans are kept whole as JSON so nothing is lost if the table changes later
+	_, err = tx.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS orphaned_comments (
+			id SERIAL PRIMARY KEY,
+			comment_id INTEGER NOT NULL,
+			blog_id INTEGER NOT NULL,
+			data JSONB NOT NULL,
+			quarantined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		log.Fatalf("Failed to create orphaned_comments table: %v", err)
+	}
+
+	result, err := tx.Exec(ctx, `
+		INSERT INTO orphaned_comments (comment_id, blog_id, data)
+		SELECT c.id, c.blog_id, to_jsonb(c) FROM comments c
+		WHERE NOT EXISTS (SELECT 1 FROM blogs b WHERE b.id = c.blog_id)
+	`)
+	if err != nil {
+		log.Fatalf("Failed to quarantine orphaned comments: %v", err)
+	}
+	if orphans := result.RowsAffected(); orphans > 0 {
+		log.Printf("Quarantined %d comments on deleted blogs into orphaned_comments", orphans)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM comments c WHERE NOT EXISTS (SELECT 1 FROM blogs b WHERE b.id = c.blog_id)
+	`)
+	if err != nil {
+		log.Fatalf("Failed to remove orphaned comments: %v", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		ALTER TABLE comments ADD CONSTRAINT comments_blog_id_fkey
+			FOREIGN KEY (blog_id) REFERENCES blogs(id) ON DELETE CASCADE
+	`)
+	if err != nil {
+		log.Fatalf("Failed to add comments foreign key: %v", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_comments_blog_id ON comments (blog_id);
+		UPDATE comments c SET blog_slug = b.slug FROM blogs b
+		WHERE b.id = c.blog_id AND c.blog_slug IS DISTINCT FROM b.slug
+	`)
+	if err != nil {
+		log.Fatalf("Failed to refresh comment blog slugs: %v", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Fatalf("Failed to link comments to blogs: %v", err)
+	}
 }
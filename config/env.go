@@ -0,0 +1,24 @@
+package config
+
+import (
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// LoadEnv reads a .env file into the environment if there is one
+func LoadEnv() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found, using environment variables")
+	}
+}
+
+// DatabaseURL returns DATABASE_URL, exiting if it isn't set
+func DatabaseURL() string {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		log.Fatal("DATABASE_URL environment variable not set")
+	}
+	return databaseURL
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// privateNetworks are the ranges a platform's edge proxy connects from. Railway
+// routes public traffic through its proxy over a private network.
+var privateNetworks = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"fc00::/7",
+	"::1/128",
+}
+
+// TrustedProxies lists the proxies whose X-Forwarded-For and X-Real-IP headers
+// are believed when working out a client's IP. TRUSTED_PROXIES takes
+// comma-separated IPs or CIDRs. Unset, private networks are trusted on Railway
+// and nothing elsewhere, so clients can't choose their own IP.
+func TrustedProxies() []string {
+	if value := os.Getenv("TRUSTED_PROXIES"); value != "" {
+		var proxies []string
+		for _, proxy := range strings.Split(value, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				proxies = append(proxies, proxy)
+			}
+		}
+		return proxies
+	}
+	if os.Getenv("RAILWAY_ENVIRONMENT") != "" {
+		return privateNetworks
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/aslotsu/monkreflections-form-api/config"
+	"github.com/aslotsu/monkreflections-form-api/middleware"
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// auditTables maps audited resource types to their tables
+var auditTables = map[string]string{
+	models.AuditResourceBlog:           "blogs",
+	models.AuditResourceBlogImage:      "blog_images",
+	models.AuditResourceEvent:          "events",
+	models.AuditResourceBook:           "books",
+	models.AuditResourceForm:           "forms",
+	models.AuditResourceFormSubmission: "form_submissions",
+	models.AuditResourceComment:        "comments",
+}
+
+// auditOmittedFields are left out of snapshots. Deleting a submission, comment
+// or event must not leave the respondent's answers or a person's contact details
+// behind in the audit log.
+var auditOmittedFields = map[string][]string{
+	models.AuditResourceFormSubmission: {"data", "ip_address", "user_agent"},
+	models.AuditResourceComment:        {"author_email", "ip_address"},
+	models.AuditResourceEvent:          {"organizer_email", "organizer_phone"},
+}
+
+// auditActor identifies who made a request, for the audit log
+func auditActor(c *gin.Context) models.AuditActor {
+	actor := models.AuditActor{
+		Name:      middleware.ActorName(c),
+		Type:      models.ActorTypeAPIKey,
+		IPAddress: c.ClientIP(),
+		RequestID: c.GetString(middleware.ContextRequestID),
+	}
+	if id, ok := c.Get(middleware.ContextUserID); ok {
+		userID := id.(int)
+		actor.Type = models.ActorTypeUser
+		actor.ID = &userID
+	} else if id := c.GetInt(middleware.ContextAPIKeyID); id != 0 {
+		actor.ID = &id
+	}
+	return actor
+}
+
+// snapshotRows loads rows of an audited resource as JSON objects keyed by ID.
+// Rows that don't exist are left out.
+func snapshotRows(ctx context.Context, tx pgx.Tx, resource string, ids ...int) (map[int]map[string]any, error) {
+	rows, err := tx.Query(
+		ctx,
+		"SELECT id, to_jsonb(t) - COALESCE($2::text[], '{}') FROM "+auditTables[resource]+" t WHERE id = ANY($1)",
+		ids, auditOmittedFields[resource],
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := make(map[int]map[string]any)
+	for rows.Next() {
+		var id int
+		var row map[string]any
+		if err := rows.Scan(&id, &row); err != nil {
+			return nil, err
+		}
+		snapshots[id] = row
+	}
+	return snapshots, rows.Err()
+}
+
+// recordAudit writes an audit entry for each of ids, changed in tx. before
+// holds their snapshots from before the change (nil for creates); the after
+// state is loaded here, so call it after the change and before committing.
+func recordAudit(ctx context.Context, tx pgx.Tx, actor models.AuditActor, action, resource string, before map[int]map[string]any, ids ...int) error {
+	var after map[int]map[string]any
+	if action != models.AuditActionDelete {
+		var err error
+		if after, err = snapshotRows(ctx, tx, resource, ids...); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range ids {
+		changedBefore, changedAfter := auditDiff(before[id], after[id])
+		_, err := tx.Exec(
+			ctx,
+			`INSERT INTO audit_log (actor, actor_type, actor_id, action, resource_type, resource_id,
+				before, after, ip_address, request_id)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7::jsonb, 'null'), NULLIF($8::jsonb, 'null'), NULLIF($9, ''), NULLIF($10, ''))`,
+			actor.Name, actor.Type, actor.ID, action, resource, id,
+			changedBefore, changedAfter, actor.IPAddress, actor.RequestID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execAudited runs query, an update or delete of row id of resource, in a
+// transaction with its audit entry. Nothing is recorded if no row changed.
+func execAudited(c *gin.Context, db config.DB, action, resource string, id int, query string, args ...any) (int64, error) {
+	ctx := context.Background()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := snapshotRows(ctx, tx, resource, id)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	if result.RowsAffected() == 0 {
+		return 0, nil
+	}
+	if err := recordAudit(ctx, tx, auditActor(c), action, resource, before, id); err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), tx.Commit(ctx)
+}
+
+// insertAudited runs query, an insert of one row of resource returning its
+// id, in a transaction with its audit entry
+func insertAudited(c *gin.Context, db config.DB, resource string, query string, args ...any) (int, error) {
+	ctx := context.Background()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	if err := tx.QueryRow(ctx, query, args...).Scan(&id); err != nil {
+		return 0, err
+	}
+	if err := recordAudit(ctx, tx, auditActor(c), models.AuditActionCreate, resource, nil, id); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit(ctx)
+}
+
+// auditDiff reduces the snapshots of an updated row to the fields that
+// changed. updated_at is left out since every update changes it.
+func auditDiff(before, after map[string]any) (map[string]any, map[string]any) {
+	if before == nil || after == nil {
+		return before, after
+	}
+	changedBefore := make(map[string]any)
+	changedAfter := make(map[string]any)
+	for field, value := range after {
+		if field == "updated_at" || reflect.DeepEqual(before[field], value) {
+			continue
+		}
+		changedBefore[field] = before[field]
+		changedAfter[field] = value
+	}
+	return changedBefore, changedAfter
+}
+
+type AuditHandler struct {
+	db config.DB
+}
+
+func NewAuditHandler(db config.DB) *AuditHandler {
+	return &AuditHandler{db: db}
+}
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// GetAuditLog lists audit entries, newest first, filtered by any of actor,
+// actor_type, actor_id, action, resource_type, resource_id, request_id, from
+// and to. Pass the last entry's ID as before_id for the next page.
+func (h *AuditHandler) GetAuditLog(c *gin.Context) {
+	where := "WHERE true"
+	args := []any{}
+
+	for _, filter := range []struct{ param, condition string }{
+		{"actor", "actor = "},
+		{"actor_type", "actor_type = "},
+		{"action", "action = "},
+		{"resource_type", "resource_type = "},
+		{"request_id", "request_id = "},
+	} {
+		if value := c.Query(filter.param); value != "" {
+			args = append(args, value)
+			where += " AND " + filter.condition + "$" + strconv.Itoa(len(args))
+		}
+	}
+	for _, filter := range []struct{ param, condition string }{
+		{"actor_id", "actor_id = "},
+		{"resource_id", "resource_id = "},
+		{"before_id", "id < "},
+	} {
+		value := c.Query(filter.param)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + filter.param})
+			return
+		}
+		args = append(args, id)
+		where += " AND " + filter.condition + "$" + strconv.Itoa(len(args))
+	}
+	if from := c.Query("from"); from != "" {
+		fromTime, err := parseExportDate(from, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+			return
+		}
+		args = append(args, fromTime.UTC())
+		where += " AND created_at >= $" + strconv.Itoa(len(args))
+	}
+	if to := c.Query("to"); to != "" {
+		toTime, err := parseExportDate(to, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+			return
+		}
+		args = append(args, toTime.UTC())
+		where += " AND created_at < $" + strconv.Itoa(len(args))
+	}
+
+	limit := defaultAuditLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxAuditLimit)})
+			return
+		}
+		limit = n
+	}
+	args = append(args, limit)
+
+	rows, err := h.db.Query(
+		context.Background(),
+		`SELECT id, actor, actor_type, actor_id, action, resource_type, resource_id, before, after,
+			COALESCE(ip_address, ''), COALESCE(request_id, ''), created_at
+		FROM audit_log `+where+` ORDER BY id DESC LIMIT $`+strconv.Itoa(len(args)),
+		args...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		if err := rows.Scan(
+			&entry.ID, &entry.Actor, &entry.ActorType, &entry.ActorID, &entry.Action,
+			&entry.ResourceType, &entry.ResourceID, &entry.Before, &entry.After,
+			&entry.IPAddress, &entry.RequestID, &entry.CreatedAt,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan audit entry"})
+			return
+		}
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
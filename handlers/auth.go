@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aslotsu/monkreflections-form-api/config"
+	"github.com/aslotsu/monkreflections-form-api/middleware"
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// SessionConfig controls admin login sessions and their cookie
+type SessionConfig struct {
+	TTL            time.Duration
+	CookieDomain   string
+	CookieSecure   bool
+	CookieSameSite http.SameSite
+	TOTPIssuer     string // shown in authenticator apps
+}
+
+type AuthHandler struct {
+	db      config.DB
+	config  SessionConfig
+	limiter services.RateLimiter // login attempts, per IP and per email
+}
+
+func NewAuthHandler(db config.DB, config SessionConfig, limiter services.RateLimiter) *AuthHandler {
+	return &AuthHandler{
+		db:      db,
+		config:  config,
+		limiter: limiter,
+	}
+}
+
+const adminUserColumns = `id, email, name, role, slug, COALESCE(bio, ''), totp_enabled, disabled_at, last_login_at, created_at, updated_at`
+
+func scanAdminUser(row pgx.Row, extra ...any) (models.AdminUser, error) {
+	var user models.AdminUser
+	dest := []any{
+		&user.ID, &user.Email, &user.Name, &user.Role, &user.Slug, &user.Bio, &user.TOTPEnabled,
+		&user.DisabledAt, &user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return user, err
+}
+
+// Login checks an admin's email, password and (once enabled) TOTP code, and
+// starts a session held in an HttpOnly cookie. The response's csrf_token must
+// be sent in the X-CSRF-Token header on requests that change anything.
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	for _, key := range []string{"ip:" + c.ClientIP(), "email:" + email} {
+		if ok, retryAfter := h.limiter.Allow(key); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many login attempts, please try again later"})
+			return
+		}
+	}
+
+	ctx := context.Background()
+	var passwordHash, totpSecret string
+	var totpLastStep int64
+	user, err := scanAdminUser(
+		h.db.QueryRow(ctx, "SELECT "+adminUserColumns+", password_hash, COALESCE(totp_secret, ''), totp_last_step FROM admin_users WHERE email = $1", email),
+		&passwordHash, &totpSecret, &totpLastStep,
+	)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+			return
+		}
+		services.SpendPasswordCheck(req.Password)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	valid, err := services.VerifyPassword(req.Password, passwordHash)
+	if err != nil {
+		log.Printf("Admin user %d has an unreadable password hash: %v", user.ID, err)
+	}
+	if !valid || user.DisabledAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	if user.TOTPEnabled {
+		if req.TOTPCode == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor code required", "totp_required": true})
+			return
+		}
+		if !h.useTOTPCode(ctx, user.ID, totpSecret, req.TOTPCode, totpLastStep) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code", "totp_required": true})
+			return
+		}
+	}
+
+	token, err := services.NewToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	csrfToken, err := services.NewToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	expiresAt := time.Now().UTC().Add(h.config.TTL).Truncate(time.Second)
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Expired sessions are cleared out whenever the user logs in again
+	_, err = tx.Exec(
+		ctx,
+		"DELETE FROM admin_sessions WHERE user_id = $1 AND expires_at <= (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')",
+		user.ID,
+	)
+	if err == nil {
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO admin_sessions (user_id, token_hash, csrf_token, ip_address, user_agent, expires_at)
+			VALUES ($1, $2, $3, $4, LEFT($5, 500), $6)`,
+			user.ID, services.HashToken(token), csrfToken, c.ClientIP(), c.Request.UserAgent(), expiresAt,
+		)
+	}
+	if err == nil {
+		_, err = tx.Exec(ctx, "UPDATE admin_users SET last_login_at = (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') WHERE id = $1", user.ID)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	h.setSessionCookie(c, token, int(h.config.TTL.Seconds()))
+	c.JSON(http.StatusOK, gin.H{"user": user, "csrf_token": csrfToken, "expires_at": expiresAt})
+}
+
+// Logout ends the current session
+func (h *AuthHandler) Logout(c *gin.Context) {
+	_, err := h.db.Exec(context.Background(), "DELETE FROM admin_sessions WHERE id = $1", c.GetInt(middleware.ContextSessionID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	h.setSessionCookie(c, "", -1)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// GetCurrentUser returns the logged-in user and the session's CSRF token, so
+// the dashboard can recover it after a page reload
+func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
+	user, err := scanAdminUser(h.db.QueryRow(
+		context.Background(),
+		"SELECT "+adminUserColumns+" FROM admin_users WHERE id = $1",
+		c.GetInt(middleware.ContextUserID),
+	))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user, "csrf_token": c.GetString(middleware.ContextCSRFToken)})
+}
+
+// UpdateProfile changes the logged-in user's name and public bio
+func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := scanAdminUser(h.db.QueryRow(
+		context.Background(),
+		`UPDATE admin_users SET name = COALESCE($2, name), bio = COALESCE($3, bio), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 RETURNING `+adminUserColumns,
+		c.GetInt(middleware.ContextUserID), req.Name, req.Bio,
+	))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ChangePassword sets a new password and signs out the user's other sessions
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	userID := c.GetInt(middleware.ContextUserID)
+	if !h.checkPassword(c, userID, req.CurrentPassword) {
+		return
+	}
+
+	hash, err := services.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE admin_users SET password_hash = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1", userID, hash)
+	if err == nil {
+		_, err = tx.Exec(
+			ctx,
+			"DELETE FROM admin_sessions WHERE user_id = $1 AND id <> $2",
+			userID, c.GetInt(middleware.ContextSessionID),
+		)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed; other sessions have been signed out"})
+}
+
+// SetupTOTP generates a new TOTP secret for the user. Two-factor login starts
+// once a code from it is confirmed with EnableTOTP.
+func (h *AuthHandler) SetupTOTP(c *gin.Context) {
+	secret, err := services.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+
+	result, err := h.db.Exec(
+		context.Background(),
+		"UPDATE admin_users SET totp_secret = $2, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND NOT totp_enabled",
+		c.GetInt(middleware.ContextUserID), secret,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_url": services.TOTPURL(h.config.TOTPIssuer, c.GetString(middleware.ContextUserEmail), secret),
+	})
+}
+
+// EnableTOTP turns on two-factor login after checking a code from the new secret
+func (h *AuthHandler) EnableTOTP(c *gin.Context) {
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	userID := c.GetInt(middleware.ContextUserID)
+	var secret string
+	var enabled bool
+	var lastStep int64
+	err := h.db.QueryRow(
+		ctx,
+		"SELECT COALESCE(totp_secret, ''), totp_enabled, totp_last_step FROM admin_users WHERE id = $1",
+		userID,
+	).Scan(&secret, &enabled, &lastStep)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if secret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set up two-factor authentication first"})
+		return
+	}
+	if !h.useTOTPCode(ctx, userID, secret, req.Code, lastStep) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	_, err = h.db.Exec(ctx, "UPDATE admin_users SET totp_enabled = true, updated_at = CURRENT_TIMESTAMP WHERE id = $1", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled"})
+}
+
+// DisableTOTP turns off two-factor login; it needs both the password and a current code
+func (h *AuthHandler) DisableTOTP(c *gin.Context) {
+	var req models.DisableTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	userID := c.GetInt(middleware.ContextUserID)
+	if !h.checkPassword(c, userID, req.Password) {
+		return
+	}
+
+	var secret string
+	var enabled bool
+	var lastStep int64
+	err := h.db.QueryRow(
+		ctx,
+		"SELECT COALESCE(totp_secret, ''), totp_enabled, totp_last_step FROM admin_users WHERE id = $1",
+		userID,
+	).Scan(&secret, &enabled, &lastStep)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !h.useTOTPCode(ctx, userID, secret, req.Code, lastStep) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	_, err = h.db.Exec(
+		ctx,
+		"UPDATE admin_users SET totp_enabled = false, totp_secret = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1",
+		userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// checkPassword verifies the logged-in user's password, responding if it's wrong
+func (h *AuthHandler) checkPassword(c *gin.Context, userID int, password string) bool {
+	var hash string
+	err := h.db.QueryRow(context.Background(), "SELECT password_hash FROM admin_users WHERE id = $1", userID).Scan(&hash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check password"})
+		return false
+	}
+	if ok, _ := services.VerifyPassword(password, hash); !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Incorrect password"})
+		return false
+	}
+	return true
+}
+
+// useTOTPCode validates a code and records its time step, so each code works once
+func (h *AuthHandler) useTOTPCode(ctx context.Context, userID int, secret, code string, lastStep int64) bool {
+	step, ok := services.ValidateTOTP(secret, code, lastStep, time.Now())
+	if !ok {
+		return false
+	}
+	result, err := h.db.Exec(
+		ctx,
+		"UPDATE admin_users SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2",
+		userID, step,
+	)
+	return err == nil && result.RowsAffected() == 1
+}
+
+func (h *AuthHandler) setSessionCookie(c *gin.Context, token string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     middleware.SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   h.config.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   h.config.CookieSecure,
+		HttpOnly: true,
+		SameSite: h.config.CookieSameSite,
+	})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aslotsu/monkreflections-form-api/config"
+	"github.com/aslotsu/monkreflections-form-api/middleware"
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// contentOwner is the user recorded as a blog's author or an event or book's
+// creator. ID is nil for content created with an API key and no user named.
+type contentOwner struct {
+	ID   *int
+	Name string
+}
+
+// resolveOwner works out who owns content being created or reassigned.
+// Signed-in users own what they create; editors and API keys may name another
+// user with requestedID. API key requests naming no one are recorded under the
+// key's name. It responds with an error and returns false if the request isn't
+// allowed.
+func resolveOwner(c *gin.Context, db config.DB, requestedID *int) (contentOwner, bool) {
+	userID, signedIn := c.Get(middleware.ContextUserID)
+	if requestedID == nil {
+		if !signedIn {
+			return contentOwner{Name: middleware.ActorName(c)}, true
+		}
+		id := userID.(int)
+		return contentOwner{ID: &id, Name: c.GetString(middleware.ContextUserName)}, true
+	}
+
+	if c.GetString(middleware.ContextUserRole) == models.RoleAuthor && *requestedID != userID.(int) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Authors can only publish as themselves"})
+		return contentOwner{}, false
+	}
+
+	owner := contentOwner{ID: requestedID}
+	err := db.QueryRow(
+		context.Background(),
+		"SELECT name FROM admin_users WHERE id = $1 AND disabled_at IS NULL",
+		*requestedID,
+	).Scan(&owner.Name)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No active user with that ID"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up user"})
+		}
+		return contentOwner{}, false
+	}
+	return owner, true
+}
+
+// canEdit reports whether the request may change content owned by ownerID.
+// Authors may only change their own; editors and API keys may change anything.
+// It responds with 403 when it returns false.
+func canEdit(c *gin.Context, ownerID *int, what string) bool {
+	if c.GetString(middleware.ContextUserRole) != models.RoleAuthor {
+		return true
+	}
+	if ownerID != nil && *ownerID == c.GetInt(middleware.ContextUserID) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Authors can only change their own " + what})
+	return false
+}
+
+// blogOwner loads the author of a blog for canEdit
+func blogOwner(db config.DB, id int) (*int, error) {
+	var ownerID *int
+	err := db.QueryRow(context.Background(), "SELECT author_id FROM blogs WHERE id = $1", id).Scan(&ownerID)
+	return ownerID, err
+}
+
+// eventOwner loads the creator of an event for canEdit
+func eventOwner(db config.DB, id int) (*int, error) {
+	var ownerID *int
+	err := db.QueryRow(context.Background(), "SELECT created_by_id FROM events WHERE id = $1", id).Scan(&ownerID)
+	return ownerID, err
+}
+
+// AuthorHandler serves public author profiles
+type AuthorHandler struct {
+	db config.DB
+}
+
+func NewAuthorHandler(db config.DB) *AuthorHandler {
+	return &AuthorHandler{db: db}
+}
+
+// authorColumns lists the public profile columns of admin_users u in the order
+// scanAuthor reads them
+const authorColumns = `u.slug, u.name, COALESCE(u.bio, ''),
+	(SELECT COUNT(*) FROM blogs WHERE blogs.author_id = u.id)`
+
+func scanAuthor(row pgx.Row) (models.Author, error) {
+	var author models.Author
+	err := row.Scan(&author.Slug, &author.Name, &author.Bio, &author.PostCount)
+	return author, err
+}
+
+// GetAuthors lists the authors with at least one published post
+func (h *AuthorHandler) GetAuthors(c *gin.Context) {
+	rows, err := h.db.Query(context.Background(), `
+		SELECT `+authorColumns+`
+		FROM admin_users u
+		WHERE u.disabled_at IS NULL AND EXISTS(SELECT 1 FROM blogs WHERE blogs.author_id = u.id)
+		ORDER BY u.name
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch authors"})
+		return
+	}
+	defer rows.Close()
+
+	authors := []models.Author{}
+	for rows.Next() {
+		author, err := scanAuthor(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan author"})
+			return
+		}
+		authors = append(authors, author)
+	}
+
+	c.JSON(http.StatusOK, authors)
+}
+
+// GetAuthor returns an author's profile and published posts, newest first.
+// Users who haven't published anything have no public profile.
+func (h *AuthorHandler) GetAuthor(c *gin.Context) {
+	ctx := context.Background()
+
+	var profile models.AuthorProfile
+	var userID int
+	err := h.db.QueryRow(
+		ctx,
+		`SELECT `+authorColumns+`, u.id FROM admin_users u
+		WHERE u.slug = $1 AND u.disabled_at IS NULL AND EXISTS(SELECT 1 FROM blogs WHERE blogs.author_id = u.id)`,
+		c.Param("slug"),
+	).Scan(&profile.Slug, &profile.Name, &profile.Bio, &profile.PostCount, &userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Author not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch author"})
+		}
+		return
+	}
+
+	rows, err := h.db.Query(ctx, "SELECT "+blogColumns+" FROM blogs WHERE author_id = $1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
+		return
+	}
+	defer rows.Close()
+
+	profile.Posts = []models.Blog{}
+	for rows.Next() {
+		blog, err := scanBlog(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan blog"})
+			return
+		}
+		profile.Posts = append(profile.Posts, blog)
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
@@ -3,30 +3,78 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/aslotsu/monkreflections-form-api/config"
 	"github.com/aslotsu/monkreflections-form-api/models"
 	"github.com/aslotsu/monkreflections-form-api/services"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 )
 
 type BlogHandler struct {
-	db       *pgxpool.Pool
-	s3Service *services.S3Service
+	db      config.DB
+	storage services.Storage
+	images  *services.ImageProcessor
+
+	// commentVerification is whether commenters must verify their email, which
+	// auto-approving comments relies on
+	commentVerification bool
+}
+
+func NewBlogHandler(db config.DB, storage services.Storage, imageSizes []services.ImageSize, commentVerification bool) *BlogHandler {
+	bh := &BlogHandler{
+		db:                  db,
+		storage:             storage,
+		commentVerification: commentVerification,
+	}
+	if storage != nil {
+		bh.images = services.NewImageProcessor(storage, imageSizes)
+	}
+	return bh
 }
 
-func NewBlogHandler(db *pgxpool.Pool, s3Service *services.S3Service) *BlogHandler {
-	return &BlogHandler{
-		db:       db,
-		s3Service: s3Service,
+// checkCommentSettings refuses settings the server can't honour, responding 400
+func (bh *BlogHandler) checkCommentSettings(c *gin.Context, settings *models.BlogCommentSettingsRequest) bool {
+	if settings != nil && settings.AutoApprove != nil && *settings.AutoApprove && !bh.commentVerification {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "auto_approve requires commenter email verification (COMMENT_EMAIL_VERIFICATION=true)"})
+		return false
 	}
+	return true
+}
+
+// blogCommentsClosesAtSQL is when a blogs row stops taking comments, NULL if never
+const blogCommentsClosesAtSQL = `blogs.created_at + make_interval(days => blogs.comments_close_after_days)`
+
+// blogCommentsOpenSQL reports whether a blogs row currently accepts comments
+const blogCommentsOpenSQL = `(blogs.comments_enabled AND (blogs.comments_close_after_days IS NULL
+	OR ` + blogCommentsClosesAtSQL + ` > LOCALTIMESTAMP))`
+
+// blogColumns lists the blog columns in the order scanBlog reads them. The
+// comment count only includes comments visible to the public.
+const blogColumns = `id, title, COALESCE(slug, ''), content,
+	COALESCE((SELECT name FROM admin_users WHERE id = blogs.author_id), author), author_id,
+	COALESCE((SELECT slug FROM admin_users WHERE id = blogs.author_id), ''), created_at, updated_at,
+	(SELECT COUNT(*) FROM comments c WHERE c.blog_id = blogs.id AND c.status = 'approved' AND c.email_verified),
+	comments_enabled, comments_close_after_days, comments_auto_approve, comments_max_depth,
+	` + blogCommentsOpenSQL + `, ` + blogCommentsClosesAtSQL
+
+func scanBlog(row pgx.Row) (models.Blog, error) {
+	var blog models.Blog
+	settings := &blog.CommentSettings
+	err := row.Scan(
+		&blog.ID, &blog.Title, &blog.Slug, &blog.Content, &blog.Author, &blog.AuthorID, &blog.AuthorSlug, &blog.CreatedAt, &blog.UpdatedAt, &blog.CommentCount,
+		&settings.Enabled, &settings.CloseAfterDays, &settings.AutoApprove, &settings.MaxDepth,
+		&settings.Open, &settings.ClosesAt,
+	)
+	return blog, err
 }
 
 // GetAllBlogs retrieves all blogs
 func (bh *BlogHandler) GetAllBlogs(c *gin.Context) {
-	rows, err := bh.db.Query(context.Background(), "SELECT id, title, slug, content, author, created_at, updated_at FROM blogs ORDER BY created_at DESC")
+	rows, err := bh.db.Query(context.Background(), "SELECT "+blogColumns+" FROM blogs ORDER BY created_at DESC")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blogs"})
 		return
@@ -35,8 +83,8 @@ func (bh *BlogHandler) GetAllBlogs(c *gin.Context) {
 
 	var blogs []models.Blog
 	for rows.Next() {
-		var blog models.Blog
-		if err := rows.Scan(&blog.ID, &blog.Title, &blog.Slug, &blog.Content, &blog.Author, &blog.CreatedAt, &blog.UpdatedAt); err != nil {
+		blog, err := scanBlog(rows)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan blog"})
 			return
 		}
@@ -58,12 +106,11 @@ func (bh *BlogHandler) GetBlogByID(c *gin.Context) {
 		return
 	}
 
-	var blog models.Blog
-	err = bh.db.QueryRow(
+	blog, err := scanBlog(bh.db.QueryRow(
 		context.Background(),
-		"SELECT id, title, slug, content, author, created_at, updated_at FROM blogs WHERE id = $1",
+		"SELECT "+blogColumns+" FROM blogs WHERE id = $1",
 		id,
-	).Scan(&blog.ID, &blog.Title, &blog.Slug, &blog.Content, &blog.Author, &blog.CreatedAt, &blog.UpdatedAt)
+	))
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Blog not found"})
@@ -88,14 +135,35 @@ func (bh *BlogHandler) CreateBlog(c *gin.Context) {
 		return
 	}
 
-	var id int
-	err = bh.db.QueryRow(
-		context.Background(),
-		"INSERT INTO blogs (title, content, author) VALUES ($1, $2, $3) RETURNING id",
+	if !bh.checkCommentSettings(c, req.CommentSettings) {
+		return
+	}
+
+	owner, ok := resolveOwner(c, bh.db, req.AuthorID)
+	if !ok {
+		return
+	}
+
+	settings := req.CommentSettings
+	if settings == nil {
+		settings = &models.BlogCommentSettingsRequest{}
+	}
+
+	id, err := insertAudited(
+		c, bh.db, models.AuditResourceBlog,
+		`INSERT INTO blogs (title, content, author, author_id,
+			comments_enabled, comments_close_after_days, comments_auto_approve, comments_max_depth)
+		VALUES ($1, $2, $3, $4, COALESCE($5, true), NULLIF($6, 0), COALESCE($7, false), NULLIF($8, 0))
+		RETURNING id`,
 		req.Title,
 		string(contentBytes),
-		req.Author,
-	).Scan(&id)
+		owner.Name,
+		owner.ID,
+		settings.Enabled,
+		settings.CloseAfterDays,
+		settings.AutoApprove,
+		settings.MaxDepth,
+	)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create blog"})
@@ -118,14 +186,19 @@ func (bh *BlogHandler) UpdateBlog(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !bh.checkCommentSettings(c, req.CommentSettings) {
+		return
+	}
 
 	// Check if blog exists
-	var exists bool
-	err = bh.db.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM blogs WHERE id = $1)", id).Scan(&exists)
-	if err != nil || !exists {
+	ownerID, err := blogOwner(bh.db, id)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Blog not found"})
 		return
 	}
+	if !canEdit(c, ownerID, "blogs") {
+		return
+	}
 
 	// Build dynamic update query
 	var contentStr string
@@ -149,15 +222,39 @@ func (bh *BlogHandler) UpdateBlog(c *gin.Context) {
 		query += ", content = $" + strconv.Itoa(len(args)+1)
 		args = append(args, contentStr)
 	}
-	if req.Author != "" {
+	if req.AuthorID != nil {
+		owner, ok := resolveOwner(c, bh.db, req.AuthorID)
+		if !ok {
+			return
+		}
+		query += ", author_id = $" + strconv.Itoa(len(args)+1)
+		args = append(args, owner.ID)
 		query += ", author = $" + strconv.Itoa(len(args)+1)
-		args = append(args, req.Author)
+		args = append(args, owner.Name)
+	}
+	if settings := req.CommentSettings; settings != nil {
+		if settings.Enabled != nil {
+			query += ", comments_enabled = $" + strconv.Itoa(len(args)+1)
+			args = append(args, *settings.Enabled)
+		}
+		if settings.CloseAfterDays != nil {
+			query += ", comments_close_after_days = NULLIF($" + strconv.Itoa(len(args)+1) + ", 0)"
+			args = append(args, *settings.CloseAfterDays)
+		}
+		if settings.AutoApprove != nil {
+			query += ", comments_auto_approve = $" + strconv.Itoa(len(args)+1)
+			args = append(args, *settings.AutoApprove)
+		}
+		if settings.MaxDepth != nil {
+			query += ", comments_max_depth = NULLIF($" + strconv.Itoa(len(args)+1) + ", 0)"
+			args = append(args, *settings.MaxDepth)
+		}
 	}
 
 	query += " WHERE id = $" + strconv.Itoa(len(args)+1)
 	args = append(args, id)
 
-	_, err = bh.db.Exec(context.Background(), query, args...)
+	_, err = execAudited(c, bh.db, models.AuditActionUpdate, models.AuditResourceBlog, id, query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update blog"})
 		return
@@ -174,13 +271,22 @@ func (bh *BlogHandler) DeleteBlog(c *gin.Context) {
 		return
 	}
 
-	result, err := bh.db.Exec(context.Background(), "DELETE FROM blogs WHERE id = $1", id)
+	ownerID, err := blogOwner(bh.db, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blog not found"})
+		return
+	}
+	if !canEdit(c, ownerID, "blogs") {
+		return
+	}
+
+	deleted, err := execAudited(c, bh.db, models.AuditActionDelete, models.AuditResourceBlog, id, "DELETE FROM blogs WHERE id = $1", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete blog"})
 		return
 	}
 
-	if result.RowsAffected() == 0 {
+	if deleted == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Blog not found"})
 		return
 	}
@@ -190,10 +296,10 @@ func (bh *BlogHandler) DeleteBlog(c *gin.Context) {
 
 // UploadBlogImage handles image uploads for a blog
 func (bh *BlogHandler) UploadBlogImage(c *gin.Context) {
-	// Check if S3 service is available
-	if bh.s3Service == nil {
+	// Check if storage is available
+	if bh.storage == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Image upload service is not available. S3 is not configured.",
+			"error": "Image upload service is not available. Storage is not configured.",
 		})
 		return
 	}
@@ -205,12 +311,14 @@ func (bh *BlogHandler) UploadBlogImage(c *gin.Context) {
 	}
 
 	// Check if blog exists
-	var exists bool
-	err = bh.db.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM blogs WHERE id = $1)", blogID).Scan(&exists)
-	if err != nil || !exists {
+	ownerID, err := blogOwner(bh.db, blogID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Blog not found"})
 		return
 	}
+	if !canEdit(c, ownerID, "blogs") {
+		return
+	}
 
 	file, header, err := c.Request.FormFile("image")
 	if err != nil {
@@ -219,42 +327,104 @@ func (bh *BlogHandler) UploadBlogImage(c *gin.Context) {
 	}
 	defer file.Close()
 
-	// Upload to S3
-	imageKey, imageURL, err := bh.s3Service.UploadImage(file, header.Size, header.Filename)
+	// Upload to storage, with variants
+	image, err := bh.images.Upload(context.Background(), file, header.Size, header.Filename)
 	if err != nil {
+		var rejection *services.ImageRejection
+		if errors.As(err, &rejection) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image: " + rejection.Message})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image: " + err.Error()})
 		return
 	}
+	image.BlogID = blogID
+	image.AltText = c.PostForm("alt_text")
 
 	// Store image reference in database
-	var imageID int
-	err = bh.db.QueryRow(
-		context.Background(),
-		"INSERT INTO blog_images (blog_id, image_key, image_url, alt_text) VALUES ($1, $2, $3, $4) RETURNING id",
-		blogID, imageKey, imageURL, c.PostForm("alt_text"),
-	).Scan(&imageID)
+	image.ID, err = insertAudited(c, bh.db, models.AuditResourceBlogImage, insertBlogImageSQL, blogImageInsertArgs(image)...)
 
 	if err != nil {
-		// If database insertion fails, try to delete the uploaded image from S3
-		deleteErr := bh.s3Service.DeleteImage(imageKey)
+		// If database insertion fails, try to delete the uploaded files from storage
+		deleteErr := bh.images.Delete(context.Background(), image)
 		if deleteErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":          "Failed to store image reference in database",
-				"cleanup_error":  "Also failed to cleanup S3 image",
+				"cleanup_error":  "Also failed to cleanup stored image",
 				"cleanup_detail": deleteErr.Error(),
 			})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":         "Failed to store image reference in database",
-				"cleanup_msg":   "Successfully cleaned up S3 image",
+				"error":       "Failed to store image reference in database",
+				"cleanup_msg": "Successfully cleaned up stored image",
 			})
 		}
 		return
 	}
+	// Respond with the row as stored
+	if stored, err := scanBlogImage(bh.db.QueryRow(
+		context.Background(),
+		"SELECT "+blogImageColumns+" FROM blog_images WHERE id = $1",
+		image.ID,
+	)); err == nil {
+		image = stored
+	}
+
+	c.JSON(http.StatusCreated, image)
+}
+
+// insertBlogImageSQL inserts a processed image with blogImageInsertArgs, returning its ID
+const insertBlogImageSQL = `INSERT INTO blog_images (blog_id, image_key, image_url, width, height, webp_key, webp_url, variants, alt_text)
+	VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8, $9) RETURNING id`
+
+func blogImageInsertArgs(image models.BlogImage) []any {
+	return []any{
+		image.BlogID, image.ImageKey, image.ImageURL, image.Width, image.Height,
+		image.WebPKey, image.WebPURL, image.Variants, image.AltText,
+	}
+}
+
+// blogImageColumns lists the blog_images columns in the order scanBlogImage reads them
+const blogImageColumns = `id, blog_id, image_key, image_url, COALESCE(width, 0), COALESCE(height, 0),
+	COALESCE(webp_key, ''), COALESCE(webp_url, ''), variants, COALESCE(alt_text, ''), created_at`
+
+func scanBlogImage(row pgx.Row) (models.BlogImage, error) {
+	var image models.BlogImage
+	err := row.Scan(
+		&image.ID, &image.BlogID, &image.ImageKey, &image.ImageURL, &image.Width, &image.Height,
+		&image.WebPKey, &image.WebPURL, &image.Variants, &image.AltText, &image.CreatedAt,
+	)
+	return image, err
+}
+
+// GetBlogImages lists a blog's images with their variants, oldest first
+func (bh *BlogHandler) GetBlogImages(c *gin.Context) {
+	blogID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid blog ID"})
+		return
+	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"id":        imageID,
-		"image_url": imageURL,
-		"image_key": imageKey,
-	})
-}
\ No newline at end of file
+	rows, err := bh.db.Query(
+		context.Background(),
+		"SELECT "+blogImageColumns+" FROM blog_images WHERE blog_id = $1 ORDER BY id",
+		blogID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch images"})
+		return
+	}
+	defer rows.Close()
+
+	images := []models.BlogImage{}
+	for rows.Next() {
+		image, err := scanBlogImage(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan image"})
+			return
+		}
+		images = append(images, image)
+	}
+
+	c.JSON(http.StatusOK, images)
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// How long a presigned upload URL can be used
+	blogImageUploadURLExpiry = 15 * time.Minute
+
+	// How long an upload can be completed before it and its file are removed
+	blogImageUploadExpiry = time.Hour
+)
+
+// CreateBlogImageUpload issues a presigned URL for uploading a blog image
+// straight to storage, for images too large to send through the API. Once the
+// file is uploaded, CompleteBlogImageUpload processes it into a blog image.
+func (bh *BlogHandler) CreateBlogImageUpload(c *gin.Context) {
+	if bh.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Image upload service is not available. Storage is not configured.",
+		})
+		return
+	}
+
+	blogID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid blog ID"})
+		return
+	}
+
+	ownerID, err := blogOwner(bh.db, blogID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blog not found"})
+		return
+	}
+	if !canEdit(c, ownerID, "blogs") {
+		return
+	}
+
+	var req models.CreateBlogImageUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !services.IsImageContentType(req.ContentType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content_type must be image/jpeg, image/png or image/gif"})
+		return
+	}
+	if req.Size > services.MaxDirectImageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File too large: maximum %d bytes allowed", services.MaxDirectImageSize)})
+		return
+	}
+
+	uploadID := uuid.New().String()
+	objectKey := "uploads/blogs/" + uploadID
+
+	ctx := context.Background()
+	presigned, err := bh.storage.PresignUpload(ctx, objectKey, req.ContentType, req.Size, blogImageUploadURLExpiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload URL"})
+		return
+	}
+
+	var expiresAt time.Time
+	err = bh.db.QueryRow(
+		ctx,
+		`INSERT INTO blog_image_uploads (id, blog_id, object_key, filename, content_type, size_bytes, alt_text, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') + make_interval(secs => $8))
+		RETURNING expires_at`,
+		uploadID, blogID, objectKey, req.Filename, req.ContentType, req.Size, req.AltText, blogImageUploadExpiry.Seconds(),
+	).Scan(&expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"upload_id":      uploadID,
+		"method":         presigned.Method,
+		"url":            presigned.URL,
+		"headers":        presigned.Headers,
+		"url_expires_at": time.Now().Add(blogImageUploadURLExpiry).UTC(),
+		"expires_at":     expiresAt,
+	})
+}
+
+// CompleteBlogImageUpload checks that a presigned upload's file arrived as
+// declared, then validates and processes it like a multipart upload and adds
+// it to the blog. An upload can only be completed once; if it fails it can be
+// retried until the upload expires.
+func (bh *BlogHandler) CompleteBlogImageUpload(c *gin.Context) {
+	if bh.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Image upload service is not available. Storage is not configured.",
+		})
+		return
+	}
+
+	blogID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid blog ID"})
+		return
+	}
+	uploadID, err := uuid.Parse(c.Param("upload_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload ID"})
+		return
+	}
+
+	ownerID, err := blogOwner(bh.db, blogID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blog not found"})
+		return
+	}
+	if !canEdit(c, ownerID, "blogs") {
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := bh.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete upload"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Deleting the row claims it, so concurrent completions can't both add the image
+	var objectKey, filename, contentType, altText string
+	var size int64
+	err = tx.QueryRow(
+		ctx,
+		`DELETE FROM blog_image_uploads
+		WHERE id = $1 AND blog_id = $2 AND expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')
+		RETURNING object_key, filename, content_type, size_bytes, COALESCE(alt_text, '')`,
+		uploadID.String(), blogID,
+	).Scan(&objectKey, &filename, &contentType, &size, &altText)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found or expired"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete upload"})
+		}
+		return
+	}
+
+	info, err := bh.storage.Stat(ctx, objectKey)
+	if err != nil {
+		if errors.Is(err, services.ErrObjectNotFound) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The file has not been uploaded yet"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check upload"})
+		}
+		return
+	}
+	if info.Size != size || (info.ContentType != "" && info.ContentType != contentType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The uploaded file does not match the declared size or content type"})
+		return
+	}
+
+	image, err := bh.images.UploadStored(ctx, objectKey, size, filename)
+	if err != nil {
+		var rejection *services.ImageRejection
+		if errors.As(err, &rejection) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image: " + rejection.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image"})
+		return
+	}
+	image.BlogID = blogID
+	image.AltText = altText
+
+	// Remove the processed files if the image can't be recorded
+	saved := false
+	defer func() {
+		if !saved {
+			if err := bh.images.Delete(ctx, image); err != nil {
+				log.Printf("Failed to clean up blog image %s: %v", image.ImageKey, err)
+			}
+		}
+	}()
+
+	if err := tx.QueryRow(ctx, insertBlogImageSQL, blogImageInsertArgs(image)...).Scan(&image.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image reference in database"})
+		return
+	}
+	if err := recordAudit(ctx, tx, auditActor(c), models.AuditActionCreate, models.AuditResourceBlogImage, nil, image.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image reference in database"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image reference in database"})
+		return
+	}
+	saved = true
+
+	// The processed copies replace the uploaded original
+	if err := bh.storage.Delete(ctx, objectKey); err != nil {
+		log.Printf("Failed to delete completed upload %s: %v", objectKey, err)
+	}
+
+	if stored, err := scanBlogImage(bh.db.QueryRow(ctx, "SELECT "+blogImageColumns+" FROM blog_images WHERE id = $1", image.ID)); err == nil {
+		image = stored
+	}
+
+	c.JSON(http.StatusCreated, image)
+}
+
+// CleanupExpiredImageUploads removes presigned uploads that were never
+// completed, and their files. It returns the number removed.
+func (bh *BlogHandler) CleanupExpiredImageUploads() (int, error) {
+	if bh.storage == nil {
+		return 0, nil
+	}
+
+	ctx := context.Background()
+	rows, err := bh.db.Query(
+		ctx,
+		"DELETE FROM blog_image_uploads WHERE expires_at <= (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') RETURNING object_key",
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove expired image uploads: %v", err)
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove expired image uploads: %v", err)
+	}
+
+	for _, key := range keys {
+		if err := bh.storage.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete expired image upload %s: %v", key, err)
+		}
+	}
+	return len(keys), nil
+}
@@ -5,16 +5,16 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/aslotsu/monkreflections-form-api/config"
 	"github.com/aslotsu/monkreflections-form-api/models"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type BookHandler struct {
-	db *pgxpool.Pool
+	db config.DB
 }
 
-func NewBookHandler(db *pgxpool.Pool) *BookHandler {
+func NewBookHandler(db config.DB) *BookHandler {
 	return &BookHandler{db: db}
 }
 
@@ -25,7 +25,8 @@ func (h *BookHandler) GetAllBooks(c *gin.Context) {
 		       pages, language, category, price, sale_price, stock_quantity, status,
 		       cover_image, gallery_images, preview_url, purchase_links, tags,
 		       is_featured, is_published, total_sales, average_rating, review_count,
-		       created_by, created_at, updated_at
+		       COALESCE((SELECT name FROM admin_users WHERE id = books.created_by_id), created_by, ''), created_by_id,
+		       created_at, updated_at
 		FROM books
 		ORDER BY created_at DESC
 	`
@@ -47,7 +48,7 @@ func (h *BookHandler) GetAllBooks(c *gin.Context) {
 			&book.StockQuantity, &book.Status, &book.CoverImage, &book.GalleryImages,
 			&book.PreviewURL, &book.PurchaseLinks, &book.Tags,
 			&book.IsFeatured, &book.IsPublished, &book.TotalSales, &book.AverageRating,
-			&book.ReviewCount, &book.CreatedBy, &book.CreatedAt, &book.UpdatedAt,
+			&book.ReviewCount, &book.CreatedBy, &book.CreatedByID, &book.CreatedAt, &book.UpdatedAt,
 		); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan book"})
 			return
@@ -75,7 +76,8 @@ func (h *BookHandler) GetBookByID(c *gin.Context) {
 		       pages, language, category, price, sale_price, stock_quantity, status,
 		       cover_image, gallery_images, preview_url, purchase_links, tags,
 		       is_featured, is_published, total_sales, average_rating, review_count,
-		       created_by, created_at, updated_at
+		       COALESCE((SELECT name FROM admin_users WHERE id = books.created_by_id), created_by, ''), created_by_id,
+		       created_at, updated_at
 		FROM books
 		WHERE id = $1
 	`
@@ -88,7 +90,7 @@ func (h *BookHandler) GetBookByID(c *gin.Context) {
 		&book.StockQuantity, &book.Status, &book.CoverImage, &book.GalleryImages,
 		&book.PreviewURL, &book.PurchaseLinks, &book.Tags,
 		&book.IsFeatured, &book.IsPublished, &book.TotalSales, &book.AverageRating,
-		&book.ReviewCount, &book.CreatedBy, &book.CreatedAt, &book.UpdatedAt,
+		&book.ReviewCount, &book.CreatedBy, &book.CreatedByID, &book.CreatedAt, &book.UpdatedAt,
 	)
 
 	if err != nil {
@@ -107,6 +109,11 @@ func (h *BookHandler) CreateBook(c *gin.Context) {
 		return
 	}
 
+	owner, ok := resolveOwner(c, h.db, req.CreatedByID)
+	if !ok {
+		return
+	}
+
 	// Convert JSONB fields to strings
 	galleryImagesStr := marshalJSONB(req.GalleryImages)
 	purchaseLinksStr := marshalJSONB(req.PurchaseLinks)
@@ -117,23 +124,22 @@ func (h *BookHandler) CreateBook(c *gin.Context) {
 			title, subtitle, author, isbn, description, publisher, publication_date,
 			pages, language, category, price, sale_price, stock_quantity, status,
 			cover_image, gallery_images, preview_url, purchase_links, tags,
-			is_featured, is_published, created_by
+			is_featured, is_published, created_by, created_by_id
 		) VALUES (
 			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14,
-			$15, $16, $17, $18, $19, $20, $21, $22
+			$15, $16, $17, $18, $19, $20, $21, $22, $23
 		) RETURNING id
 	`
 
-	var id int
-	err := h.db.QueryRow(
-		context.Background(),
+	id, err := insertAudited(
+		c, h.db, models.AuditResourceBook,
 		query,
 		req.Title, req.Subtitle, req.Author, req.ISBN, req.Description,
 		req.Publisher, req.PublicationDate, req.Pages, req.Language, req.Category,
 		req.Price, req.SalePrice, req.StockQuantity, req.Status,
 		req.CoverImage, galleryImagesStr, req.PreviewURL, purchaseLinksStr, tagsStr,
-		req.IsFeatured, req.IsPublished, req.CreatedBy,
-	).Scan(&id)
+		req.IsFeatured, req.IsPublished, owner.Name, owner.ID,
+	)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create book", "details": err.Error()})
@@ -294,7 +300,7 @@ func (h *BookHandler) UpdateBook(c *gin.Context) {
 	query += " WHERE id = $" + strconv.Itoa(argCount)
 	args = append(args, id)
 
-	_, err = h.db.Exec(context.Background(), query, args...)
+	_, err = execAudited(c, h.db, models.AuditActionUpdate, models.AuditResourceBook, id, query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update book"})
 		return
@@ -311,13 +317,13 @@ func (h *BookHandler) DeleteBook(c *gin.Context) {
 		return
 	}
 
-	result, err := h.db.Exec(context.Background(), "DELETE FROM books WHERE id = $1", id)
+	deleted, err := execAudited(c, h.db, models.AuditActionDelete, models.AuditResourceBook, id, "DELETE FROM books WHERE id = $1", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book"})
 		return
 	}
 
-	if result.RowsAffected() == 0 {
+	if deleted == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
 		return
 	}
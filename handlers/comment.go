@@ -2,23 +2,48 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/aslotsu/monkreflections-form-api/config"
+	"github.com/aslotsu/monkreflections-form-api/middleware"
 	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/aslotsu/monkreflections-form-api/services"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 )
 
+// CommentConfig controls commenter verification and self-service editing
+type CommentConfig struct {
+	// EditWindow is how long after posting a commenter may edit or delete their comment
+	EditWindow time.Duration
+	// RequireEmailVerification holds comments from unverified addresses until the
+	// commenter follows the link emailed to them
+	RequireEmailVerification bool
+	// VerificationURL is the page the verification link points at; it receives ?token=
+	VerificationURL string
+}
+
 type CommentHandler struct {
-	db *pgxpool.Pool
+	db         config.DB
+	spamFilter *services.SpamFilter
+	signer     *services.Signer
+	config     CommentConfig
 }
 
-func NewCommentHandler(db *pgxpool.Pool) *CommentHandler {
-	return &CommentHandler{db: db}
+func NewCommentHandler(db config.DB, spamFilter *services.SpamFilter, signer *services.Signer, config CommentConfig) *CommentHandler {
+	return &CommentHandler{
+		db:         db,
+		spamFilter: spamFilter,
+		signer:     signer,
+		config:     config,
+	}
 }
 
-// GetCommentsByBlogID retrieves all approved comments for a blog post
+// GetCommentsByBlogID retrieves all approved comments for a blog post.
+// With ?format=tree replies are nested under their parents.
 func (h *CommentHandler) GetCommentsByBlogID(c *gin.Context) {
 	blogID, err := strconv.Atoi(c.Param("blog_id"))
 	if err != nil {
@@ -26,96 +51,137 @@ func (h *CommentHandler) GetCommentsByBlogID(c *gin.Context) {
 		return
 	}
 
+	h.respondWithApprovedComments(c, "c.blog_id = $1", blogID)
+}
+
+// GetCommentsByBlogSlug retrieves all approved comments for a blog post by slug.
+// With ?format=tree replies are nested under their parents.
+func (h *CommentHandler) GetCommentsByBlogSlug(c *gin.Context) {
+	h.respondWithApprovedComments(c, "b.slug = $1", c.Param("slug"))
+}
+
+// respondWithApprovedComments lists the public view of the approved comments
+// matching filter, either flat in creation order or as a reply tree
+func (h *CommentHandler) respondWithApprovedComments(c *gin.Context, filter string, arg any) {
+	format := c.DefaultQuery("format", "flat")
+	if format != "flat" && format != "tree" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format: must be flat or tree"})
+		return
+	}
+	maxDepth := defaultCommentTreeDepth
+	if value := c.Query("max_depth"); value != "" {
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth < 1 || depth > maxCommentTreeDepth {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("max_depth must be between 1 and %d", maxCommentTreeDepth)})
+			return
+		}
+		maxDepth = depth
+	}
+
 	query := `
-		SELECT id, blog_id, blog_slug, author_name, author_email, content, status, parent_id, created_at, updated_at
-		FROM comments
-		WHERE blog_id = $1 AND status = 'approved'
-		ORDER BY created_at ASC
+		SELECT c.id, c.blog_id, COALESCE(b.slug, ''), c.author_name, c.author_email, c.content, c.parent_id,
+		       c.is_author, c.edited_at, c.deleted_at IS NOT NULL, c.created_at, c.updated_at
+		FROM comments c
+		JOIN blogs b ON b.id = c.blog_id
+		WHERE ` + filter + ` AND c.status = 'approved' AND c.email_verified
+		ORDER BY c.created_at ASC
 	`
 
-	rows, err := h.db.Query(context.Background(), query, blogID)
+	rows, err := h.db.Query(context.Background(), query, arg)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments"})
 		return
 	}
 	defer rows.Close()
 
-	var comments []models.Comment
+	var comments []models.PublicComment
 	for rows.Next() {
-		var comment models.Comment
+		var comment models.PublicComment
+		var email string
 		if err := rows.Scan(
 			&comment.ID, &comment.BlogID, &comment.BlogSlug, &comment.AuthorName,
-			&comment.AuthorEmail, &comment.Content, &comment.Status, &comment.ParentID,
-			&comment.CreatedAt, &comment.UpdatedAt,
+			&email, &comment.Content, &comment.ParentID, &comment.IsAuthor,
+			&comment.EditedAt, &comment.Deleted, &comment.CreatedAt, &comment.UpdatedAt,
 		); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan comment"})
 			return
 		}
+		comment.AvatarHash = avatarHash(email)
+		comment.Edited = comment.EditedAt != nil
 		comments = append(comments, comment)
 	}
 
 	if comments == nil {
-		comments = []models.Comment{}
+		comments = []models.PublicComment{}
 	}
 
-	c.JSON(http.StatusOK, comments)
-}
-
-// GetCommentsByBlogSlug retrieves all approved comments for a blog post by slug
-func (h *CommentHandler) GetCommentsByBlogSlug(c *gin.Context) {
-	slug := c.Param("slug")
-
-	query := `
-		SELECT id, blog_id, blog_slug, author_name, author_email, content, status, parent_id, created_at, updated_at
-		FROM comments
-		WHERE blog_slug = $1 AND status = 'approved'
-		ORDER BY created_at ASC
-	`
+	if format == "flat" {
+		c.JSON(http.StatusOK, comments)
+		return
+	}
 
-	rows, err := h.db.Query(context.Background(), query, slug)
+	// Replies can hang off comments that aren't shown, so load the hidden
+	// comments' parents to find each reply's nearest visible ancestor
+	hiddenParents := make(map[int]*int)
+	rows, err = h.db.Query(
+		context.Background(),
+		"SELECT c.id, c.parent_id FROM comments c JOIN blogs b ON b.id = c.blog_id WHERE "+filter+" AND NOT (c.status = 'approved' AND c.email_verified)",
+		arg,
+	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments"})
 		return
 	}
 	defer rows.Close()
-
-	var comments []models.Comment
 	for rows.Next() {
-		var comment models.Comment
-		if err := rows.Scan(
-			&comment.ID, &comment.BlogID, &comment.BlogSlug, &comment.AuthorName,
-			&comment.AuthorEmail, &comment.Content, &comment.Status, &comment.ParentID,
-			&comment.CreatedAt, &comment.UpdatedAt,
-		); err != nil {
+		var id int
+		var parentID *int
+		if err := rows.Scan(&id, &parentID); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan comment"})
 			return
 		}
-		comments = append(comments, comment)
+		hiddenParents[id] = parentID
 	}
 
-	if comments == nil {
-		comments = []models.Comment{}
-	}
+	c.JSON(http.StatusOK, buildCommentTree(comments, hiddenParents, maxDepth))
+}
 
-	c.JSON(http.StatusOK, comments)
+// adminCommentColumns lists the comments columns (aliased c, joined to blogs
+// as b for the slug) in the order scanComment reads them
+const adminCommentColumns = `
+		c.id, c.blog_id, COALESCE(b.slug, ''), c.author_name, c.author_email, c.content, c.status, c.parent_id,
+		c.spam_score, c.spam_reasons, COALESCE(c.moderated_by, ''), c.moderated_at, COALESCE(c.moderation_note, ''),
+		c.email_verified, c.edited_at, c.deleted_at, c.created_at, c.updated_at`
+
+func scanComment(row pgx.Row, extra ...any) (models.Comment, error) {
+	var comment models.Comment
+	dest := []any{
+		&comment.ID, &comment.BlogID, &comment.BlogSlug, &comment.AuthorName,
+		&comment.AuthorEmail, &comment.Content, &comment.Status, &comment.ParentID,
+		&comment.SpamScore, &comment.SpamReasons, &comment.ModeratedBy, &comment.ModeratedAt, &comment.ModerationNote,
+		&comment.EmailVerified, &comment.EditedAt, &comment.DeletedAt, &comment.CreatedAt, &comment.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return comment, err
 }
 
 // GetAllComments retrieves all comments (for admin, includes pending/rejected)
 func (h *CommentHandler) GetAllComments(c *gin.Context) {
 	status := c.Query("status") // optional filter by status
 
-	query := `
-		SELECT id, blog_id, blog_slug, author_name, author_email, content, status, parent_id, created_at, updated_at
-		FROM comments
-	`
+	query := "SELECT " + adminCommentColumns + " FROM comments c JOIN blogs b ON b.id = c.blog_id"
 
 	var args []interface{}
 	if status != "" {
-		query += " WHERE status = $1"
+		if !validCommentStatus(status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status: must be pending, approved, rejected or spam"})
+			return
+		}
+		query += " WHERE c.status = $1"
 		args = append(args, status)
 	}
 
-	query += " ORDER BY created_at DESC"
+	query += " ORDER BY c.created_at DESC"
 
 	rows, err := h.db.Query(context.Background(), query, args...)
 	if err != nil {
@@ -126,12 +192,8 @@ func (h *CommentHandler) GetAllComments(c *gin.Context) {
 
 	var comments []models.Comment
 	for rows.Next() {
-		var comment models.Comment
-		if err := rows.Scan(
-			&comment.ID, &comment.BlogID, &comment.BlogSlug, &comment.AuthorName,
-			&comment.AuthorEmail, &comment.Content, &comment.Status, &comment.ParentID,
-			&comment.CreatedAt, &comment.UpdatedAt,
-		); err != nil {
+		comment, err := scanComment(rows)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan comment"})
 			return
 		}
@@ -153,17 +215,149 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 		return
 	}
 
+	// The slug is copied from the blog so it can't disagree with blog_id
+	var blogSlug string
+	var commentsOpen, autoApprove bool
+	var maxDepth, authorID *int
+	err := h.db.QueryRow(
+		context.Background(),
+		"SELECT COALESCE(slug, ''), "+blogCommentsOpenSQL+", comments_auto_approve, comments_max_depth, author_id FROM blogs WHERE id = $1",
+		req.BlogID,
+	).Scan(&blogSlug, &commentsOpen, &autoApprove, &maxDepth, &authorID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Blog not found"})
+		return
+	}
+	if !commentsOpen {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Comments are closed on this blog"})
+		return
+	}
+
+	// Replies must be to a visible comment on the same blog
+	if req.ParentID != nil {
+		var parentBlogID int
+		var parentStatus string
+		err := h.db.QueryRow(
+			context.Background(),
+			"SELECT blog_id, status FROM comments WHERE id = $1",
+			*req.ParentID,
+		).Scan(&parentBlogID, &parentStatus)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent comment not found"})
+			return
+		}
+		if parentBlogID != req.BlogID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent comment belongs to a different blog"})
+			return
+		}
+		if parentStatus != models.CommentStatusApproved {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot reply to a comment that is not approved"})
+			return
+		}
+
+		if maxDepth != nil {
+			// The parent's depth is the length of its ancestor chain, itself included
+			var parentDepth int
+			err := h.db.QueryRow(
+				context.Background(),
+				`WITH RECURSIVE ancestors AS (
+					SELECT id, parent_id FROM comments WHERE id = $1
+					UNION ALL
+					SELECT c.id, c.parent_id FROM comments c JOIN ancestors a ON c.id = a.parent_id
+				)
+				SELECT COUNT(*) FROM ancestors`,
+				*req.ParentID,
+			).Scan(&parentDepth)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+				return
+			}
+			if parentDepth+1 > *maxDepth {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Replies can only be nested %d levels deep on this blog", *maxDepth)})
+				return
+			}
+		}
+	}
+
+	verdict, ok := evaluateSpam(c, h.spamFilter, services.SpamSubmission{
+		IP:          c.ClientIP(),
+		Email:       req.AuthorEmail,
+		Name:        req.AuthorName,
+		Content:     req.Content,
+		Honeypot:    req.Website,
+		Token:       req.SpamToken,
+		ProofOfWork: req.PowNonce,
+	})
+	if !ok {
+		return
+	}
+
+	// Likely spam skips the moderation queue; the response is the same either way
+	status := models.CommentStatusPending
+	if verdict.IsSpam {
+		status = models.CommentStatusSpam
+	}
+	if verdict.Reasons == nil {
+		verdict.Reasons = []string{}
+	}
+
+	// With verification on, comments from new addresses wait for the commenter to confirm
+	emailVerified := true
+	if h.config.RequireEmailVerification {
+		err := h.db.QueryRow(
+			context.Background(),
+			"SELECT EXISTS(SELECT 1 FROM verified_commenters WHERE email = LOWER($1))",
+			req.AuthorEmail,
+		).Scan(&emailVerified)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+			return
+		}
+	}
+
+	// Blogs can skip the queue for commenters who already have an approved comment.
+	// Only verification ties the address to the commenter, so without it anyone
+	// could claim a known commenter's address.
+	autoApproved := false
+	if autoApprove && h.config.RequireEmailVerification && emailVerified && status == models.CommentStatusPending {
+		err := h.db.QueryRow(
+			context.Background(),
+			"SELECT EXISTS(SELECT 1 FROM comments WHERE LOWER(author_email) = LOWER($1) AND status = 'approved')",
+			req.AuthorEmail,
+		).Scan(&autoApproved)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+			return
+		}
+		if autoApproved {
+			status = models.CommentStatusApproved
+		}
+	}
+
+	// Only the blog's author, logged in to the dashboard, gets the author badge
+	userID := c.GetInt(middleware.ContextUserID)
+	isAuthor := userID != 0 && authorID != nil && *authorID == userID
+
 	query := `
-		INSERT INTO comments (blog_id, blog_slug, author_name, author_email, content, parent_id, status)
-		VALUES ($1, $2, $3, $4, $5, $6, 'pending')
+		INSERT INTO comments (blog_id, blog_slug, author_name, author_email, content, parent_id, status, spam_score, spam_reasons, email_verified, is_author)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING id
 	`
 
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
 	var id int
-	err := h.db.QueryRow(
-		context.Background(),
+	err = tx.QueryRow(
+		ctx,
 		query,
-		req.BlogID, req.BlogSlug, req.AuthorName, req.AuthorEmail, req.Content, req.ParentID,
+		req.BlogID, blogSlug, req.AuthorName, req.AuthorEmail, req.Content, req.ParentID,
+		status, verdict.Score, verdict.Reasons, emailVerified, isAuthor,
 	).Scan(&id)
 
 	if err != nil {
@@ -171,10 +365,53 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Comment submitted for moderation"})
+	if !emailVerified {
+		if err := h.enqueueVerificationEmail(ctx, tx, req.AuthorEmail, req.AuthorName); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+			return
+		}
+	}
+
+	if autoApproved {
+		_, err := tx.Exec(
+			ctx,
+			"UPDATE comments SET moderated_by = $2, moderated_at = CURRENT_TIMESTAMP WHERE id = $1",
+			id, commentAutoApproveActor,
+		)
+		if err == nil {
+			err = recordModeration(ctx, tx, []int{id}, status, "", commentAutoApproveActor)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+		return
+	}
+
+	// The edit token is the commenter's only proof of ownership
+	editExpiresAt := time.Now().Add(h.config.EditWindow).Truncate(time.Second)
+	response := gin.H{
+		"id":              id,
+		"message":         "Comment submitted for moderation",
+		"edit_token":      h.editToken(id, editExpiresAt),
+		"edit_expires_at": editExpiresAt,
+	}
+	if autoApproved {
+		response["message"] = "Comment published"
+	}
+	if !emailVerified {
+		response["message"] = "Check your email to confirm your comment"
+		response["verification_required"] = true
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
-// UpdateComment updates comment status or content (admin only)
+// UpdateComment updates comment status or content (admin only). Status changes
+// are recorded with the moderator and an optional note.
 func (h *CommentHandler) UpdateComment(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -196,6 +433,8 @@ func (h *CommentHandler) UpdateComment(c *gin.Context) {
 		return
 	}
 
+	moderator := middleware.ActorName(c)
+
 	// Build dynamic update query
 	query := "UPDATE comments SET updated_at = CURRENT_TIMESTAMP"
 	args := []any{}
@@ -205,6 +444,12 @@ func (h *CommentHandler) UpdateComment(c *gin.Context) {
 		query += ", status = $" + strconv.Itoa(argCount)
 		args = append(args, req.Status)
 		argCount++
+		query += ", moderated_by = $" + strconv.Itoa(argCount) + ", moderated_at = CURRENT_TIMESTAMP"
+		args = append(args, moderator)
+		argCount++
+		query += ", moderation_note = NULLIF($" + strconv.Itoa(argCount) + ", '')"
+		args = append(args, req.Note)
+		argCount++
 	}
 	if req.Content != "" {
 		query += ", content = $" + strconv.Itoa(argCount)
@@ -215,12 +460,43 @@ func (h *CommentHandler) UpdateComment(c *gin.Context) {
 	query += " WHERE id = $" + strconv.Itoa(argCount)
 	args = append(args, id)
 
-	_, err = h.db.Exec(context.Background(), query, args...)
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := snapshotRows(ctx, tx, models.AuditResourceComment, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	_, err = tx.Exec(ctx, query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
 		return
 	}
 
+	if err := recordAudit(ctx, tx, auditActor(c), models.AuditActionUpdate, models.AuditResourceComment, before, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	if req.Status != "" {
+		if err := recordModeration(ctx, tx, []int{id}, req.Status, req.Note, moderator); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Comment updated successfully"})
 }
 
@@ -232,7 +508,21 @@ func (h *CommentHandler) DeleteComment(c *gin.Context) {
 		return
 	}
 
-	result, err := h.db.Exec(context.Background(), "DELETE FROM comments WHERE id = $1", id)
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := snapshotRows(ctx, tx, models.AuditResourceComment, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
+	result, err := tx.Exec(ctx, "DELETE FROM comments WHERE id = $1", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
 		return
@@ -243,5 +533,20 @@ func (h *CommentHandler) DeleteComment(c *gin.Context) {
 		return
 	}
 
+	if err := recordModeration(ctx, tx, []int{id}, moderationDeleted, "", middleware.ActorName(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
+	if err := recordAudit(ctx, tx, auditActor(c), models.AuditActionDelete, models.AuditResourceComment, before, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
 }
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/aslotsu/monkreflections-form-api/config"
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// moderationDeleted is the action recorded when a comment is deleted
+const moderationDeleted = "deleted"
+
+// moderationStatuses maps bulk actions to the status they set
+var moderationStatuses = map[string]string{
+	models.ModerationActionApprove: models.CommentStatusApproved,
+	models.ModerationActionReject:  models.CommentStatusRejected,
+	models.ModerationActionSpam:    models.CommentStatusSpam,
+}
+
+func validCommentStatus(status string) bool {
+	switch status {
+	case models.CommentStatusPending, models.CommentStatusApproved,
+		models.CommentStatusRejected, models.CommentStatusSpam:
+		return true
+	}
+	return false
+}
+
+// recordModeration logs a moderation decision for each comment
+func recordModeration(ctx context.Context, tx pgx.Tx, ids []int, action, note, moderator string) error {
+	_, err := tx.Exec(
+		ctx,
+		`INSERT INTO comment_moderations (comment_id, action, note, moderator)
+		SELECT id, $2, NULLIF($3, ''), $4 FROM unnest($1::integer[]) AS id`,
+		ids, action, note, moderator,
+	)
+	return err
+}
+
+// BulkModerateComments approves, rejects, marks as spam or deletes many comments
+// at once (admin only). Either every comment is moderated or none are.
+func (h *CommentHandler) BulkModerateComments(c *gin.Context) {
+	var req models.BulkModerationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slices.Sort(req.IDs)
+	ids := slices.Compact(req.IDs)
+
+	missing, err := ModerateComments(context.Background(), h.db, ids, req.Action, req.Note, auditActor(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate comments"})
+		return
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Some comments were not found; nothing was changed", "missing_ids": missing})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comments moderated successfully", "action": req.Action, "count": len(ids)})
+}
+
+// ModerateComments applies a bulk moderation action (approve, reject, spam or
+// delete) to distinct comment IDs in one transaction. If any comment doesn't
+// exist nothing changes and the missing IDs are returned. The admin CLI shares it.
+// The actor is recorded as the moderator and in the audit log.
+func ModerateComments(ctx context.Context, db config.DB, ids []int, action, note string, actor models.AuditActor) ([]int, error) {
+	moderator := actor.Name
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := snapshotRows(ctx, tx, models.AuditResourceComment, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows pgx.Rows
+	recorded := moderationDeleted
+	audited := models.AuditActionDelete
+	if action == models.ModerationActionDelete {
+		rows, err = tx.Query(ctx, "DELETE FROM comments WHERE id = ANY($1) RETURNING id", ids)
+	} else {
+		status, ok := moderationStatuses[action]
+		if !ok {
+			return nil, fmt.Errorf("unknown moderation action %q", action)
+		}
+		recorded = status
+		audited = models.AuditActionUpdate
+		rows, err = tx.Query(
+			ctx,
+			`UPDATE comments SET status = $2, moderated_by = $3, moderated_at = CURRENT_TIMESTAMP,
+				moderation_note = NULLIF($4, ''), updated_at = CURRENT_TIMESTAMP
+			WHERE id = ANY($1) RETURNING id`,
+			ids, status, moderator, note,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	affected, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(affected) != len(ids) {
+		missing := slices.DeleteFunc(slices.Clone(ids), func(id int) bool {
+			return slices.Contains(affected, id)
+		})
+		return missing, nil
+	}
+
+	if err := recordModeration(ctx, tx, ids, recorded, note, moderator); err != nil {
+		return nil, err
+	}
+	if err := recordAudit(ctx, tx, actor, audited, models.AuditResourceComment, before, ids...); err != nil {
+		return nil, err
+	}
+
+	return nil, tx.Commit(ctx)
+}
+
+// GetModerationQueue lists pending comments grouped by blog, blogs with the
+// longest-waiting comment first (admin only)
+func (h *CommentHandler) GetModerationQueue(c *gin.Context) {
+	query := `
+		SELECT ` + adminCommentColumns + `, COALESCE(b.title, ''), COALESCE(b.slug, '')
+		FROM comments c
+		JOIN blogs b ON b.id = c.blog_id
+		WHERE c.status = 'pending' AND c.email_verified
+		ORDER BY c.created_at ASC
+	`
+
+	rows, err := h.db.Query(context.Background(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch moderation queue"})
+		return
+	}
+	defer rows.Close()
+
+	queue := []*models.ModerationQueueBlog{}
+	byBlog := make(map[int]*models.ModerationQueueBlog)
+	total := 0
+	for rows.Next() {
+		var blogTitle, blogSlug string
+		comment, err := scanComment(rows, &blogTitle, &blogSlug)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan comment"})
+			return
+		}
+
+		group, ok := byBlog[comment.BlogID]
+		if !ok {
+			group = &models.ModerationQueueBlog{BlogID: comment.BlogID, BlogTitle: blogTitle, BlogSlug: blogSlug}
+			byBlog[comment.BlogID] = group
+			queue = append(queue, group)
+		}
+		group.Comments = append(group.Comments, comment)
+		group.PendingCount++
+		total++
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total_pending": total, "blogs": queue})
+}
+
+// GetCommentModerations lists the moderation history of a comment (admin only)
+func (h *CommentHandler) GetCommentModerations(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	rows, err := h.db.Query(
+		context.Background(),
+		`SELECT id, comment_id, action, COALESCE(note, ''), moderator, created_at
+		FROM comment_moderations WHERE comment_id = $1 ORDER BY created_at DESC`,
+		id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch moderation history"})
+		return
+	}
+	defer rows.Close()
+
+	var moderations []models.CommentModeration
+	for rows.Next() {
+		var m models.CommentModeration
+		if err := rows.Scan(&m.ID, &m.CommentID, &m.Action, &m.Note, &m.Moderator, &m.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan moderation"})
+			return
+		}
+		moderations = append(moderations, m)
+	}
+
+	if moderations == nil {
+		moderations = []models.CommentModeration{}
+	}
+
+	c.JSON(http.StatusOK, moderations)
+}
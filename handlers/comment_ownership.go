@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// commentVerificationExpiry is how long an emailed verification link stays valid
+	commentVerificationExpiry = 48 * time.Hour
+
+	// commentOwnerActor is recorded as the moderator when commenters delete their
+	// own comments, or edit them back into moderation
+	commentOwnerActor = "comment author"
+
+	// commentEditedNote is the moderation note on comments sent back to moderation by an edit
+	commentEditedNote = "edited by the commenter"
+
+	// commentAutoApproveActor is recorded as the moderator of comments approved by a blog's settings
+	commentAutoApproveActor = "auto-approve"
+)
+
+// editToken signs "edit.<comment id>.<expiry>"
+func (h *CommentHandler) editToken(commentID int, expiresAt time.Time) string {
+	return h.signer.Sign(fmt.Sprintf("edit.%d.%d", commentID, expiresAt.Unix()))
+}
+
+// checkEditToken reports whether the request's X-Edit-Token is a current edit token for the comment
+func (h *CommentHandler) checkEditToken(c *gin.Context, commentID int) bool {
+	payload, ok := h.signer.Verify(c.GetHeader("X-Edit-Token"))
+	if !ok {
+		return false
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 || parts[0] != "edit" || parts[1] != strconv.Itoa(commentID) {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	return err == nil && time.Now().Unix() < expires
+}
+
+// enqueueVerificationEmail queues the double opt-in link for a commenter's address
+func (h *CommentHandler) enqueueVerificationEmail(ctx context.Context, tx pgx.Tx, email, name string) error {
+	expires := time.Now().Add(commentVerificationExpiry).Unix()
+	token := h.signer.Sign(fmt.Sprintf("verify.%d.%s", expires, strings.ToLower(email)))
+	link := h.config.VerificationURL + "?token=" + url.QueryEscape(token)
+
+	body := fmt.Sprintf(
+		"Hi %s,\n\nPlease confirm your email address so your comment can be published:\n\n%s\n\n"+
+			"The link expires in 48 hours. If you didn't leave a comment, you can ignore this email.\n",
+		name, link,
+	)
+	return services.EnqueueEmail(ctx, tx, email, "Confirm your comment", body)
+}
+
+// VerifyCommenter confirms a commenter's email address from the emailed token.
+// All their comments waiting on verification enter moderation, and later
+// comments from the address skip verification.
+func (h *CommentHandler) VerifyCommenter(c *gin.Context) {
+	var req models.VerifyCommenterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payload, ok := h.signer.Verify(req.Token)
+	parts := strings.SplitN(payload, ".", 3)
+	if !ok || len(parts) != 3 || parts[0] != "verify" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification token"})
+		return
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification link has expired"})
+		return
+	}
+	email := parts[2]
+
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "INSERT INTO verified_commenters (email) VALUES ($1) ON CONFLICT (email) DO NOTHING", email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	result, err := tx.Exec(
+		ctx,
+		"UPDATE comments SET email_verified = true WHERE LOWER(author_email) = $1 AND NOT email_verified",
+		email,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified", "comments": result.RowsAffected()})
+}
+
+// UpdateOwnComment lets a commenter edit their comment with the edit token
+// returned when it was created. The previous content is kept. The new content
+// goes through the spam filter, and an approved comment goes back to moderation
+// so it can't be swapped for something that wouldn't have been approved.
+func (h *CommentHandler) UpdateOwnComment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	if !h.checkEditToken(c, id) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired edit token"})
+		return
+	}
+
+	var req models.UpdateOwnCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var previous, status, authorName, authorEmail string
+	err = tx.QueryRow(
+		ctx,
+		"SELECT content, status, author_name, author_email FROM comments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE",
+		id,
+	).Scan(&previous, &status, &authorName, &authorEmail)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	if previous == req.Content {
+		c.JSON(http.StatusOK, gin.H{"message": "Comment unchanged"})
+		return
+	}
+
+	verdict, ok := evaluateSpam(c, h.spamFilter, services.SpamSubmission{
+		IP:          c.ClientIP(),
+		Email:       authorEmail,
+		Name:        authorName,
+		Content:     req.Content,
+		Honeypot:    req.Website,
+		Token:       req.SpamToken,
+		ProofOfWork: req.PowNonce,
+	})
+	if !ok {
+		return
+	}
+	if verdict.Reasons == nil {
+		verdict.Reasons = []string{}
+	}
+
+	newStatus := status
+	if verdict.IsSpam {
+		newStatus = models.CommentStatusSpam
+	} else if status == models.CommentStatusApproved {
+		newStatus = models.CommentStatusPending
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO comment_edits (comment_id, previous_content) VALUES ($1, $2)", id, previous)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE comments SET content = $1, spam_score = $2, spam_reasons = $3,
+			edited_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4`,
+		req.Content, verdict.Score, verdict.Reasons, id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	if newStatus != status {
+		_, err := tx.Exec(
+			ctx,
+			`UPDATE comments SET status = $2, moderated_by = $3, moderated_at = CURRENT_TIMESTAMP, moderation_note = $4
+			WHERE id = $1`,
+			id, newStatus, commentOwnerActor, commentEditedNote,
+		)
+		if err == nil {
+			err = recordModeration(ctx, tx, []int{id}, newStatus, commentEditedNote, commentOwnerActor)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	// Likely spam gets the same response as a comment waiting for moderation
+	if newStatus != status {
+		c.JSON(http.StatusOK, gin.H{"message": "Comment updated and sent for moderation"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Comment updated successfully"})
+}
+
+// DeleteOwnComment lets a commenter delete their comment with its edit token.
+// A comment with replies is emptied instead, with its earlier versions removed,
+// so other people's replies aren't deleted along with it.
+func (h *CommentHandler) DeleteOwnComment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	if !h.checkEditToken(c, id) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired edit token"})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var hasReplies bool
+	err = tx.QueryRow(
+		ctx,
+		`SELECT EXISTS(SELECT 1 FROM comments r WHERE r.parent_id = c.id)
+		FROM comments c WHERE c.id = $1 AND c.deleted_at IS NULL FOR UPDATE`,
+		id,
+	).Scan(&hasReplies)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		}
+		return
+	}
+
+	if hasReplies {
+		_, err = tx.Exec(
+			ctx,
+			`UPDATE comments SET content = '', author_name = '', author_email = '',
+				deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1`,
+			id,
+		)
+		if err == nil {
+			_, err = tx.Exec(ctx, "DELETE FROM comment_edits WHERE comment_id = $1", id)
+		}
+	} else {
+		_, err = tx.Exec(ctx, "DELETE FROM comments WHERE id = $1", id)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
+	if err := recordModeration(ctx, tx, []int{id}, moderationDeleted, "", commentOwnerActor); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+}
+
+// GetCommentEdits lists a comment's earlier versions, newest first (admin only)
+func (h *CommentHandler) GetCommentEdits(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	rows, err := h.db.Query(
+		context.Background(),
+		"SELECT id, comment_id, previous_content, edited_at FROM comment_edits WHERE comment_id = $1 ORDER BY edited_at DESC",
+		id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comment edits"})
+		return
+	}
+	defer rows.Close()
+
+	var edits []models.CommentEdit
+	for rows.Next() {
+		var edit models.CommentEdit
+		if err := rows.Scan(&edit.ID, &edit.CommentID, &edit.PreviousContent, &edit.EditedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan comment edit"})
+			return
+		}
+		edits = append(edits, edit)
+	}
+
+	if edits == nil {
+		edits = []models.CommentEdit{}
+	}
+
+	c.JSON(http.StatusOK, edits)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/aslotsu/monkreflections-form-api/models"
+)
+
+const (
+	defaultCommentTreeDepth = 5
+	maxCommentTreeDepth     = 10
+)
+
+// buildCommentTree nests approved comments under their replies' parents. A reply
+// whose parent isn't approved moves up to its nearest approved ancestor (or the
+// top level), and replies deeper than maxDepth are shown at the deepest level
+// under their ancestor there. ParentID always keeps the original parent.
+func buildCommentTree(comments []models.PublicComment, hiddenParents map[int]*int, maxDepth int) []*models.CommentThread {
+	nodes := make(map[int]*models.CommentThread, len(comments))
+	for _, comment := range comments {
+		nodes[comment.ID] = &models.CommentThread{PublicComment: comment, Replies: []*models.CommentThread{}}
+	}
+
+	// visibleParent walks up through hidden comments to the nearest approved one
+	visibleParent := func(parentID *int) *models.CommentThread {
+		for steps := 0; parentID != nil && steps <= len(hiddenParents); steps++ {
+			if node, ok := nodes[*parentID]; ok {
+				return node
+			}
+			parentID = hiddenParents[*parentID]
+		}
+		return nil
+	}
+
+	parents := make(map[int]*models.CommentThread, len(comments))
+	for _, comment := range comments {
+		if parent := visibleParent(comment.ParentID); parent != nil && parent.ID != comment.ID {
+			parents[comment.ID] = parent
+		}
+	}
+
+	roots := []*models.CommentThread{}
+	// Comments arrive oldest first, so replies end up in chronological order
+	for _, comment := range comments {
+		node := nodes[comment.ID]
+
+		var ancestors []*models.CommentThread
+		for p := parents[comment.ID]; p != nil && len(ancestors) <= len(comments); p = parents[p.ID] {
+			ancestors = append(ancestors, p)
+		}
+
+		switch {
+		case len(ancestors) == 0:
+			roots = append(roots, node)
+		case len(ancestors) <= maxDepth:
+			ancestors[0].Replies = append(ancestors[0].Replies, node)
+		default:
+			// ancestors runs from the parent up to the root
+			limit := ancestors[len(ancestors)-maxDepth]
+			limit.Replies = append(limit.Replies, node)
+		}
+	}
+
+	return roots
+}
+
+// avatarHash is the Gravatar hash of an email address, so clients can show an
+// avatar without ever seeing the address
+func avatarHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
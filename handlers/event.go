@@ -6,37 +6,82 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/aslotsu/monkreflections-form-api/config"
+	"github.com/aslotsu/monkreflections-form-api/middleware"
 	"github.com/aslotsu/monkreflections-form-api/models"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 )
 
 type EventHandler struct {
-	db *pgxpool.Pool
+	db config.DB
 }
 
-func NewEventHandler(db *pgxpool.Pool) *EventHandler {
+func NewEventHandler(db config.DB) *EventHandler {
 	return &EventHandler{db: db}
 }
 
-// GetAllEvents retrieves all events
+// eventColumns lists the events columns in the order scanEvent reads them
+const eventColumns = `
+		id, title, description, event_type, status, start_date, end_date,
+		venue_name, venue_address, is_virtual, virtual_link, timezone,
+		capacity, expected_guests, registered_count, actual_guests,
+		waitlist_enabled, allow_walkins, ticket_price, early_bird_price,
+		organization_budget, expenses, revenue,
+		registration_open_date, registration_close_date, registration_form_url,
+		requires_approval, featured_image, gallery_images, video_url, livestream_url,
+		organizer_name, organizer_email, organizer_phone,
+		speakers, sponsors, tags, is_featured, is_public,
+		COALESCE((SELECT name FROM admin_users WHERE id = events.created_by_id), created_by, ''), created_by_id,
+		created_at, updated_at`
+
+func scanEvent(row pgx.Row) (models.Event, error) {
+	var event models.Event
+	err := row.Scan(
+		&event.ID, &event.Title, &event.Description, &event.EventType, &event.Status,
+		&event.StartDate, &event.EndDate, &event.VenueName, &event.VenueAddress,
+		&event.IsVirtual, &event.VirtualLink, &event.Timezone,
+		&event.Capacity, &event.ExpectedGuests, &event.RegisteredCount, &event.ActualGuests,
+		&event.WaitlistEnabled, &event.AllowWalkins, &event.TicketPrice, &event.EarlyBirdPrice,
+		&event.OrganizationBudget, &event.Expenses, &event.Revenue,
+		&event.RegistrationOpenDate, &event.RegistrationCloseDate, &event.RegistrationFormURL,
+		&event.RequiresApproval, &event.FeaturedImage, &event.GalleryImages, &event.VideoURL,
+		&event.LivestreamURL, &event.OrganizerName, &event.OrganizerEmail, &event.OrganizerPhone,
+		&event.Speakers, &event.Sponsors, &event.Tags, &event.IsFeatured, &event.IsPublic,
+		&event.CreatedBy, &event.CreatedByID, &event.CreatedAt, &event.UpdatedAt,
+	)
+	return event, err
+}
+
+// publicEvent removes the organizer's contact details before an event is served publicly
+func publicEvent(event models.Event) models.Event {
+	event.OrganizerEmail = ""
+	event.OrganizerPhone = ""
+	return event
+}
+
+// GetAllEvents retrieves all events, without organizer contact details
 func (h *EventHandler) GetAllEvents(c *gin.Context) {
-	query := `
-		SELECT id, title, description, event_type, status, start_date, end_date,
-		       venue_name, venue_address, is_virtual, virtual_link, timezone,
-		       capacity, expected_guests, registered_count, actual_guests,
-		       waitlist_enabled, allow_walkins, ticket_price, early_bird_price,
-		       organization_budget, expenses, revenue,
-		       registration_open_date, registration_close_date, registration_form_url,
-		       requires_approval, featured_image, gallery_images, video_url, livestream_url,
-		       organizer_name, organizer_email, organizer_phone,
-		       speakers, sponsors, tags, is_featured, is_public, created_by,
-		       created_at, updated_at
-		FROM events
-		ORDER BY start_date DESC
-	`
+	h.respondWithEvents(c, false)
+}
+
+// GetAllEventsAdmin retrieves all events including organizer contact details
+// (admin only). Authors get only the events they created.
+func (h *EventHandler) GetAllEventsAdmin(c *gin.Context) {
+	h.respondWithEvents(c, true)
+}
 
-	rows, err := h.db.Query(context.Background(), query)
+func (h *EventHandler) respondWithEvents(c *gin.Context, admin bool) {
+	query := "SELECT " + eventColumns + " FROM events"
+	var args []any
+	// Organizer contact details are only shown to authors for their own events
+	if admin && c.GetString(middleware.ContextUserRole) == models.RoleAuthor {
+		query += " WHERE created_by_id = $1"
+		args = append(args, c.GetInt(middleware.ContextUserID))
+	}
+	query += " ORDER BY start_date DESC"
+
+	rows, err := h.db.Query(context.Background(), query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
 		return
@@ -45,23 +90,14 @@ func (h *EventHandler) GetAllEvents(c *gin.Context) {
 
 	var events []models.Event
 	for rows.Next() {
-		var event models.Event
-		if err := rows.Scan(
-			&event.ID, &event.Title, &event.Description, &event.EventType, &event.Status,
-			&event.StartDate, &event.EndDate, &event.VenueName, &event.VenueAddress,
-			&event.IsVirtual, &event.VirtualLink, &event.Timezone,
-			&event.Capacity, &event.ExpectedGuests, &event.RegisteredCount, &event.ActualGuests,
-			&event.WaitlistEnabled, &event.AllowWalkins, &event.TicketPrice, &event.EarlyBirdPrice,
-			&event.OrganizationBudget, &event.Expenses, &event.Revenue,
-			&event.RegistrationOpenDate, &event.RegistrationCloseDate, &event.RegistrationFormURL,
-			&event.RequiresApproval, &event.FeaturedImage, &event.GalleryImages, &event.VideoURL,
-			&event.LivestreamURL, &event.OrganizerName, &event.OrganizerEmail, &event.OrganizerPhone,
-			&event.Speakers, &event.Sponsors, &event.Tags, &event.IsFeatured, &event.IsPublic,
-			&event.CreatedBy, &event.CreatedAt, &event.UpdatedAt,
-		); err != nil {
+		event, err := scanEvent(rows)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan event"})
 			return
 		}
+		if !admin {
+			event = publicEvent(event)
+		}
 		events = append(events, event)
 	}
 
@@ -72,48 +108,37 @@ func (h *EventHandler) GetAllEvents(c *gin.Context) {
 	c.JSON(http.StatusOK, events)
 }
 
-// GetEventByID retrieves a single event by ID
+// GetEventByID retrieves a single event by ID, without organizer contact details
 func (h *EventHandler) GetEventByID(c *gin.Context) {
+	h.respondWithEvent(c, false)
+}
+
+// GetEventByIDAdmin retrieves a single event including organizer contact details
+// (admin only). Authors can only read the events they created.
+func (h *EventHandler) GetEventByIDAdmin(c *gin.Context) {
+	h.respondWithEvent(c, true)
+}
+
+func (h *EventHandler) respondWithEvent(c *gin.Context, admin bool) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
 		return
 	}
 
-	query := `
-		SELECT id, title, description, event_type, status, start_date, end_date,
-		       venue_name, venue_address, is_virtual, virtual_link, timezone,
-		       capacity, expected_guests, registered_count, actual_guests,
-		       waitlist_enabled, allow_walkins, ticket_price, early_bird_price,
-		       organization_budget, expenses, revenue,
-		       registration_open_date, registration_close_date, registration_form_url,
-		       requires_approval, featured_image, gallery_images, video_url, livestream_url,
-		       organizer_name, organizer_email, organizer_phone,
-		       speakers, sponsors, tags, is_featured, is_public, created_by,
-		       created_at, updated_at
-		FROM events
-		WHERE id = $1
-	`
-
-	var event models.Event
-	err = h.db.QueryRow(context.Background(), query, id).Scan(
-		&event.ID, &event.Title, &event.Description, &event.EventType, &event.Status,
-		&event.StartDate, &event.EndDate, &event.VenueName, &event.VenueAddress,
-		&event.IsVirtual, &event.VirtualLink, &event.Timezone,
-		&event.Capacity, &event.ExpectedGuests, &event.RegisteredCount, &event.ActualGuests,
-		&event.WaitlistEnabled, &event.AllowWalkins, &event.TicketPrice, &event.EarlyBirdPrice,
-		&event.OrganizationBudget, &event.Expenses, &event.Revenue,
-		&event.RegistrationOpenDate, &event.RegistrationCloseDate, &event.RegistrationFormURL,
-		&event.RequiresApproval, &event.FeaturedImage, &event.GalleryImages, &event.VideoURL,
-		&event.LivestreamURL, &event.OrganizerName, &event.OrganizerEmail, &event.OrganizerPhone,
-		&event.Speakers, &event.Sponsors, &event.Tags, &event.IsFeatured, &event.IsPublic,
-		&event.CreatedBy, &event.CreatedAt, &event.UpdatedAt,
-	)
-
+	event, err := scanEvent(h.db.QueryRow(context.Background(), "SELECT "+eventColumns+" FROM events WHERE id = $1", id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
 		return
 	}
+	if admin && c.GetString(middleware.ContextUserRole) == models.RoleAuthor &&
+		(event.CreatedByID == nil || *event.CreatedByID != c.GetInt(middleware.ContextUserID)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Authors can only view the admin details of their own events"})
+		return
+	}
+	if !admin {
+		event = publicEvent(event)
+	}
 
 	c.JSON(http.StatusOK, event)
 }
@@ -126,6 +151,11 @@ func (h *EventHandler) CreateEvent(c *gin.Context) {
 		return
 	}
 
+	owner, ok := resolveOwner(c, h.db, req.CreatedByID)
+	if !ok {
+		return
+	}
+
 	// Convert JSONB fields to strings
 	galleryImagesStr := marshalJSONB(req.GalleryImages)
 	speakersStr := marshalJSONB(req.Speakers)
@@ -142,17 +172,16 @@ func (h *EventHandler) CreateEvent(c *gin.Context) {
 			registration_open_date, registration_close_date, registration_form_url,
 			requires_approval, featured_image, gallery_images, video_url, livestream_url,
 			organizer_name, organizer_email, organizer_phone,
-			speakers, sponsors, tags, is_featured, is_public, created_by
+			speakers, sponsors, tags, is_featured, is_public, created_by, created_by_id
 		) VALUES (
 			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17,
 			$18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32,
-			$33, $34, $35, $36, $37, $38, $39
+			$33, $34, $35, $36, $37, $38, $39, $40
 		) RETURNING id
 	`
 
-	var id int
-	err := h.db.QueryRow(
-		context.Background(),
+	id, err := insertAudited(
+		c, h.db, models.AuditResourceEvent,
 		query,
 		req.Title, req.Description, req.EventType, req.Status, req.StartDate, req.EndDate,
 		req.VenueName, req.VenueAddress, req.IsVirtual, req.VirtualLink, req.Timezone,
@@ -162,8 +191,8 @@ func (h *EventHandler) CreateEvent(c *gin.Context) {
 		req.RegistrationOpenDate, req.RegistrationCloseDate, req.RegistrationFormURL,
 		req.RequiresApproval, req.FeaturedImage, galleryImagesStr, req.VideoURL, req.LivestreamURL,
 		req.OrganizerName, req.OrganizerEmail, req.OrganizerPhone,
-		speakersStr, sponsorsStr, tagsStr, req.IsFeatured, req.IsPublic, req.CreatedBy,
-	).Scan(&id)
+		speakersStr, sponsorsStr, tagsStr, req.IsFeatured, req.IsPublic, owner.Name, owner.ID,
+	)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event", "details": err.Error()})
@@ -188,12 +217,14 @@ func (h *EventHandler) UpdateEvent(c *gin.Context) {
 	}
 
 	// Check if event exists
-	var exists bool
-	err = h.db.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM events WHERE id = $1)", id).Scan(&exists)
-	if err != nil || !exists {
+	ownerID, err := eventOwner(h.db, id)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
 		return
 	}
+	if !canEdit(c, ownerID, "events") {
+		return
+	}
 
 	// Build dynamic update query
 	query := "UPDATE events SET updated_at = CURRENT_TIMESTAMP"
@@ -265,11 +296,23 @@ func (h *EventHandler) UpdateEvent(c *gin.Context) {
 		args = append(args, req.IsPublic)
 		argCount++
 	}
+	if req.CreatedByID != nil {
+		owner, ok := resolveOwner(c, h.db, req.CreatedByID)
+		if !ok {
+			return
+		}
+		query += ", created_by_id = $" + strconv.Itoa(argCount)
+		args = append(args, owner.ID)
+		argCount++
+		query += ", created_by = $" + strconv.Itoa(argCount)
+		args = append(args, owner.Name)
+		argCount++
+	}
 
 	query += " WHERE id = $" + strconv.Itoa(argCount)
 	args = append(args, id)
 
-	_, err = h.db.Exec(context.Background(), query, args...)
+	_, err = execAudited(c, h.db, models.AuditActionUpdate, models.AuditResourceEvent, id, query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event"})
 		return
@@ -286,13 +329,22 @@ func (h *EventHandler) DeleteEvent(c *gin.Context) {
 		return
 	}
 
-	result, err := h.db.Exec(context.Background(), "DELETE FROM events WHERE id = $1", id)
+	ownerID, err := eventOwner(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if !canEdit(c, ownerID, "events") {
+		return
+	}
+
+	deleted, err := execAudited(c, h.db, models.AuditActionDelete, models.AuditResourceEvent, id, "DELETE FROM events WHERE id = $1", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete event"})
 		return
 	}
 
-	if result.RowsAffected() == 0 {
+	if deleted == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
 		return
 	}
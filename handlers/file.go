@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+// FileHandler serves files kept by local storage
+type FileHandler struct {
+	storage *services.LocalStorage
+}
+
+func NewFileHandler(storage *services.LocalStorage) *FileHandler {
+	return &FileHandler{storage: storage}
+}
+
+// ServeFile serves a public file, or a private one with a signed URL's token
+func (h *FileHandler) ServeFile(c *gin.Context) {
+	token := c.Query("token")
+	path, ok := h.storage.File(strings.TrimPrefix(c.Param("key"), "/"), token)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	if token != "" {
+		c.Header("Cache-Control", "private, no-store")
+		c.Header("Content-Disposition", "attachment")
+	} else {
+		c.Header("Cache-Control", "public, max-age=86400")
+	}
+	c.File(path)
+}
+
+// UploadFile accepts a PUT to a presigned upload URL
+func (h *FileHandler) UploadFile(c *gin.Context) {
+	err := h.storage.AcceptUpload(
+		strings.TrimPrefix(c.Param("key"), "/"), c.Query("token"), c.GetHeader("Content-Type"), c.Request.Body,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUploadNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUploadMismatch):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		}
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -5,23 +5,61 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/aslotsu/monkreflections-form-api/config"
 	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/aslotsu/monkreflections-form-api/services"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Availability states of a form, computed by formAvailabilitySQL
+const (
+	formOpen    = "open"
+	formNotOpen = "not_open"
+	formClosed  = "closed"
+	formFull    = "full"
+)
+
+// formAvailabilitySQL evaluates a forms row's schedule and response cap. Schedule
+// times are stored in UTC.
+const formAvailabilitySQL = `CASE
+			WHEN opens_at IS NOT NULL AND opens_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') THEN 'not_open'
+			WHEN closes_at IS NOT NULL AND closes_at <= (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') THEN 'closed'
+			WHEN max_responses IS NOT NULL
+				AND (SELECT COUNT(*) FROM form_submissions s WHERE s.form_id = forms.id) >= max_responses THEN 'full'
+			ELSE 'open'
+		END`
+
 type FormHandler struct {
-	db *pgxpool.Pool
+	db         config.DB
+	storage    services.Storage
+	spamFilter *services.SpamFilter
+	// confirmations limits confirmation emails per recipient address
+	confirmations services.RateLimiter
 }
 
-func NewFormHandler(db *pgxpool.Pool) *FormHandler {
-	return &FormHandler{db: db}
+func NewFormHandler(db config.DB, storage services.Storage, spamFilter *services.SpamFilter, confirmations services.RateLimiter) *FormHandler {
+	return &FormHandler{
+		db:            db,
+		storage:       storage,
+		spamFilter:    spamFilter,
+		confirmations: confirmations,
+	}
 }
 
 // GetAllForms retrieves all forms
 func (h *FormHandler) GetAllForms(c *gin.Context) {
-	rows, err := h.db.Query(context.Background(), "SELECT id, title, data, created_at, updated_at FROM forms")
+	query := `
+		SELECT id, title, data, fields, pages, is_published, current_version,
+		       opens_at, closes_at, max_responses, COALESCE(closed_message, ''), notifications,
+		       (SELECT COUNT(*) FROM form_submissions s WHERE s.form_id = forms.id),
+		       created_at, updated_at
+		FROM forms
+		ORDER BY created_at DESC
+	`
+
+	rows, err := h.db.Query(context.Background(), query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch forms"})
 		return
@@ -31,7 +69,11 @@ func (h *FormHandler) GetAllForms(c *gin.Context) {
 	var forms []models.Form
 	for rows.Next() {
 		var form models.Form
-		if err := rows.Scan(&form.ID, &form.Title, &form.Data, &form.CreatedAt, &form.UpdatedAt); err != nil {
+		if err := rows.Scan(
+			&form.ID, &form.Title, &form.Data, &form.Fields, &form.Pages, &form.IsPublished, &form.CurrentVersion,
+			&form.OpensAt, &form.ClosesAt, &form.MaxResponses, &form.ClosedMessage, &form.Notifications,
+			&form.ResponseCount, &form.CreatedAt, &form.UpdatedAt,
+		); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan form"})
 			return
 		}
@@ -53,12 +95,21 @@ func (h *FormHandler) GetFormByID(c *gin.Context) {
 		return
 	}
 
+	query := `
+		SELECT id, title, data, fields, pages, is_published, current_version,
+		       opens_at, closes_at, max_responses, COALESCE(closed_message, ''), notifications,
+		       (SELECT COUNT(*) FROM form_submissions s WHERE s.form_id = forms.id),
+		       created_at, updated_at
+		FROM forms
+		WHERE id = $1
+	`
+
 	var form models.Form
-	err = h.db.QueryRow(
-		context.Background(),
-		"SELECT id, title, data, created_at, updated_at FROM forms WHERE id = $1",
-		id,
-	).Scan(&form.ID, &form.Title, &form.Data, &form.CreatedAt, &form.UpdatedAt)
+	err = h.db.QueryRow(context.Background(), query, id).Scan(
+		&form.ID, &form.Title, &form.Data, &form.Fields, &form.Pages, &form.IsPublished, &form.CurrentVersion,
+		&form.OpensAt, &form.ClosesAt, &form.MaxResponses, &form.ClosedMessage, &form.Notifications,
+		&form.ResponseCount, &form.CreatedAt, &form.UpdatedAt,
+	)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Form not found"})
@@ -68,6 +119,76 @@ func (h *FormHandler) GetFormByID(c *gin.Context) {
 	c.JSON(http.StatusOK, form)
 }
 
+// GetPublishedForms retrieves the public view of all published forms
+func (h *FormHandler) GetPublishedForms(c *gin.Context) {
+	query := `
+		SELECT id, title, fields, pages, current_version, opens_at, closes_at, COALESCE(closed_message, ''),
+		       ` + formAvailabilitySQL + `
+		FROM forms
+		WHERE is_published = true
+		ORDER BY created_at DESC
+	`
+
+	rows, err := h.db.Query(context.Background(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch forms"})
+		return
+	}
+	defer rows.Close()
+
+	var forms []models.PublicForm
+	for rows.Next() {
+		var form models.PublicForm
+		var availability string
+		if err := rows.Scan(
+			&form.ID, &form.Title, &form.Fields, &form.Pages, &form.Version,
+			&form.OpensAt, &form.ClosesAt, &form.ClosedMessage, &availability,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan form"})
+			return
+		}
+		form.IsOpen = availability == formOpen
+		forms = append(forms, form)
+	}
+
+	if forms == nil {
+		forms = []models.PublicForm{}
+	}
+
+	c.JSON(http.StatusOK, forms)
+}
+
+// GetPublishedFormByID retrieves the public view of a single published form
+func (h *FormHandler) GetPublishedFormByID(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form ID"})
+		return
+	}
+
+	query := `
+		SELECT id, title, fields, pages, current_version, opens_at, closes_at, COALESCE(closed_message, ''),
+		       ` + formAvailabilitySQL + `
+		FROM forms
+		WHERE id = $1 AND is_published = true
+	`
+
+	var form models.PublicForm
+	var availability string
+	err = h.db.QueryRow(context.Background(), query, id).Scan(
+		&form.ID, &form.Title, &form.Fields, &form.Pages, &form.Version,
+		&form.OpensAt, &form.ClosesAt, &form.ClosedMessage, &availability,
+	)
+
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Form not found"})
+		return
+	}
+	form.IsOpen = availability == formOpen
+
+	c.JSON(http.StatusOK, form)
+}
+
 // CreateForm creates a new form
 func (h *FormHandler) CreateForm(c *gin.Context) {
 	var req models.CreateFormRequest
@@ -76,19 +197,77 @@ func (h *FormHandler) CreateForm(c *gin.Context) {
 		return
 	}
 
-	// Convert data to JSON string
+	if req.Pages == nil {
+		req.Pages = []models.FormPage{}
+	}
+	if err := validateFormSchema(req.Fields, req.Pages); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.OpensAt = utcTime(req.OpensAt)
+	req.ClosesAt = utcTime(req.ClosesAt)
+	if req.OpensAt != nil && req.ClosesAt != nil && !req.ClosesAt.After(*req.OpensAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "closes_at must be after opens_at"})
+		return
+	}
+
+	if req.Notifications == nil {
+		req.Notifications = &models.FormNotifications{}
+	}
+	if err := validateNotifications(*req.Notifications, req.Fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Data == nil {
+		req.Data = map[string]any{}
+	}
+
+	// Convert data and schema to JSON strings
 	dataBytes, err := json.Marshal(req.Data)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format"})
 		return
 	}
+	fieldsBytes, err := json.Marshal(req.Fields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fields format"})
+		return
+	}
+	pagesBytes, err := json.Marshal(req.Pages)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pages format"})
+		return
+	}
+	notificationsBytes, err := json.Marshal(req.Notifications)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notifications format"})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create form"})
+		return
+	}
+	defer tx.Rollback(ctx)
 
 	var id int
-	err = h.db.QueryRow(
-		context.Background(),
-		"INSERT INTO forms (title, data) VALUES ($1, $2) RETURNING id",
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO forms (title, data, fields, pages, is_published, opens_at, closes_at, max_responses, closed_message, notifications)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
 		req.Title,
 		string(dataBytes),
+		string(fieldsBytes),
+		string(pagesBytes),
+		req.IsPublished,
+		req.OpensAt,
+		req.ClosesAt,
+		req.MaxResponses,
+		req.ClosedMessage,
+		string(notificationsBytes),
 	).Scan(&id)
 
 	if err != nil {
@@ -96,7 +275,28 @@ func (h *FormHandler) CreateForm(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"id": id})
+	// The initial schema is version 1
+	_, err = tx.Exec(
+		ctx,
+		"INSERT INTO form_versions (form_id, version, title, fields, pages) VALUES ($1, 1, $2, $3, $4)",
+		id, req.Title, string(fieldsBytes), string(pagesBytes),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create form"})
+		return
+	}
+
+	if err := recordAudit(ctx, tx, auditActor(c), models.AuditActionCreate, models.AuditResourceForm, nil, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create form"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create form"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "version": 1})
 }
 
 // UpdateForm updates an existing form
@@ -113,10 +313,22 @@ func (h *FormHandler) UpdateForm(c *gin.Context) {
 		return
 	}
 
-	// Check if form exists
-	var exists bool
-	err = h.db.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM forms WHERE id = $1)", id).Scan(&exists)
-	if err != nil || !exists {
+	if (req.ClearOpensAt && req.OpensAt != nil) || (req.ClearClosesAt && req.ClosesAt != nil) ||
+		(req.ClearClosedMessage && req.ClosedMessage != "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A setting can't be both set and cleared"})
+		return
+	}
+
+	// Check if form exists and load its schema so partial updates are validated as a whole
+	var currentFields []models.FormField
+	var currentPages []models.FormPage
+	var currentNotifications models.FormNotifications
+	err = h.db.QueryRow(
+		context.Background(),
+		"SELECT fields, pages, notifications FROM forms WHERE id = $1",
+		id,
+	).Scan(&currentFields, &currentPages, &currentNotifications)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Form not found"})
 		return
 	}
@@ -132,6 +344,57 @@ func (h *FormHandler) UpdateForm(c *gin.Context) {
 		dataStr = string(dataBytes)
 	}
 
+	var fieldsStr, pagesStr string
+	if req.Fields != nil || req.Pages != nil {
+		if req.Fields == nil {
+			req.Fields = currentFields
+		}
+		if req.Pages == nil {
+			req.Pages = currentPages
+		}
+		if err := validateFormSchema(req.Fields, req.Pages); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fieldsBytes, err := json.Marshal(req.Fields)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fields format"})
+			return
+		}
+		pagesBytes, err := json.Marshal(req.Pages)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pages format"})
+			return
+		}
+		fieldsStr = string(fieldsBytes)
+		pagesStr = string(pagesBytes)
+	}
+
+	// Notification settings must still hold against the resulting fields
+	var notificationsStr string
+	if req.Notifications != nil || req.Fields != nil {
+		notifications := currentNotifications
+		if req.Notifications != nil {
+			notifications = *req.Notifications
+		}
+		fields := currentFields
+		if req.Fields != nil {
+			fields = req.Fields
+		}
+		if err := validateNotifications(notifications, fields); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Notifications != nil {
+			notificationsBytes, err := json.Marshal(req.Notifications)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notifications format"})
+				return
+			}
+			notificationsStr = string(notificationsBytes)
+		}
+	}
+
 	query := "UPDATE forms SET updated_at = CURRENT_TIMESTAMP"
 	args := []any{}
 
@@ -143,17 +406,96 @@ func (h *FormHandler) UpdateForm(c *gin.Context) {
 		query += ", data = $" + strconv.Itoa(len(args)+1)
 		args = append(args, dataStr)
 	}
+	if fieldsStr != "" {
+		// Schema changes create a new version; earlier versions are never modified
+		query += ", current_version = current_version + 1"
+		query += ", fields = $" + strconv.Itoa(len(args)+1)
+		args = append(args, fieldsStr)
+		query += ", pages = $" + strconv.Itoa(len(args)+1)
+		args = append(args, pagesStr)
+	}
+	if req.IsPublished != nil {
+		query += ", is_published = $" + strconv.Itoa(len(args)+1)
+		args = append(args, *req.IsPublished)
+	}
+	req.OpensAt = utcTime(req.OpensAt)
+	req.ClosesAt = utcTime(req.ClosesAt)
+	if req.OpensAt != nil || req.ClearOpensAt {
+		query += ", opens_at = $" + strconv.Itoa(len(args)+1)
+		args = append(args, req.OpensAt)
+	}
+	if req.ClosesAt != nil || req.ClearClosesAt {
+		query += ", closes_at = $" + strconv.Itoa(len(args)+1)
+		args = append(args, req.ClosesAt)
+	}
+	if req.MaxResponses != nil {
+		query += ", max_responses = NULLIF($" + strconv.Itoa(len(args)+1) + "::integer, 0)"
+		args = append(args, *req.MaxResponses)
+	}
+	if req.ClosedMessage != "" || req.ClearClosedMessage {
+		query += ", closed_message = NULLIF($" + strconv.Itoa(len(args)+1) + ", '')"
+		args = append(args, req.ClosedMessage)
+	}
+	if notificationsStr != "" {
+		query += ", notifications = $" + strconv.Itoa(len(args)+1)
+		args = append(args, notificationsStr)
+	}
 
 	query += " WHERE id = $" + strconv.Itoa(len(args)+1)
 	args = append(args, id)
+	query += " RETURNING current_version, title, opens_at, closes_at"
 
-	_, err = h.db.Exec(context.Background(), query, args...)
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update form"})
 		return
 	}
+	defer tx.Rollback(ctx)
+
+	before, err := snapshotRows(ctx, tx, models.AuditResourceForm, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update form"})
+		return
+	}
+
+	var version int
+	var title string
+	var opensAt, closesAt *time.Time
+	err = tx.QueryRow(ctx, query, args...).Scan(&version, &title, &opensAt, &closesAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update form"})
+		return
+	}
+
+	if opensAt != nil && closesAt != nil && !closesAt.After(*opensAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "closes_at must be after opens_at"})
+		return
+	}
+
+	if fieldsStr != "" {
+		_, err = tx.Exec(
+			ctx,
+			"INSERT INTO form_versions (form_id, version, title, fields, pages) VALUES ($1, $2, $3, $4, $5)",
+			id, version, title, fieldsStr, pagesStr,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update form"})
+			return
+		}
+	}
+
+	if err := recordAudit(ctx, tx, auditActor(c), models.AuditActionUpdate, models.AuditResourceForm, before, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update form"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update form"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Form updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Form updated successfully", "version": version})
 }
 
 // DeleteForm deletes a form
@@ -164,16 +506,98 @@ func (h *FormHandler) DeleteForm(c *gin.Context) {
 		return
 	}
 
-	result, err := h.db.Exec(context.Background(), "DELETE FROM forms WHERE id = $1", id)
+	keys, err := h.uploadObjectKeys("SELECT object_key FROM form_uploads WHERE form_id = $1", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete form"})
 		return
 	}
 
-	if result.RowsAffected() == 0 {
+	deleted, err := execAudited(c, h.db, models.AuditActionDelete, models.AuditResourceForm, id, "DELETE FROM forms WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete form"})
+		return
+	}
+
+	if deleted == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Form not found"})
 		return
 	}
 
+	// Uploaded files go with the form
+	h.deleteUploadObjects(keys)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Form deleted successfully"})
 }
+
+// GetFormVersions retrieves every schema version of a form, newest first
+func (h *FormHandler) GetFormVersions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form ID"})
+		return
+	}
+
+	rows, err := h.db.Query(
+		context.Background(),
+		"SELECT id, form_id, version, title, fields, pages, created_at FROM form_versions WHERE form_id = $1 ORDER BY version DESC",
+		id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch form versions"})
+		return
+	}
+	defer rows.Close()
+
+	var versions []models.FormVersion
+	for rows.Next() {
+		var v models.FormVersion
+		if err := rows.Scan(&v.ID, &v.FormID, &v.Version, &v.Title, &v.Fields, &v.Pages, &v.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan form version"})
+			return
+		}
+		versions = append(versions, v)
+	}
+
+	if versions == nil {
+		versions = []models.FormVersion{}
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetFormVersion retrieves a single schema version of a form
+func (h *FormHandler) GetFormVersion(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form ID"})
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	var v models.FormVersion
+	err = h.db.QueryRow(
+		context.Background(),
+		"SELECT id, form_id, version, title, fields, pages, created_at FROM form_versions WHERE form_id = $1 AND version = $2",
+		id, version,
+	).Scan(&v.ID, &v.FormID, &v.Version, &v.Title, &v.Fields, &v.Pages, &v.CreatedAt)
+
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Form version not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
+
+// utcTime converts a schedule time to UTC before it is stored in a TIMESTAMP column
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
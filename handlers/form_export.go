@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// exportColumn maps a spreadsheet column to a value inside a submission
+type exportColumn struct {
+	header string
+	meta   string // "id", "form_version" or "submitted_at" for submission metadata columns
+	field  string
+	subKey string // set when the field holds a nested object
+}
+
+// ExportFormSubmissions streams a form's submissions as CSV, XLSX or JSON Lines (admin only)
+func (h *FormHandler) ExportFormSubmissions(c *gin.Context) {
+	formID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form ID"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" && format != "jsonl" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format: must be csv, xlsx or jsonl"})
+		return
+	}
+
+	// Optional date range filter on submission time
+	where := "WHERE form_id = $1"
+	args := []any{formID}
+	if from := c.Query("from"); from != "" {
+		fromTime, err := parseExportDate(from, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+			return
+		}
+		args = append(args, fromTime)
+		where += " AND created_at >= $" + strconv.Itoa(len(args))
+	}
+	if to := c.Query("to"); to != "" {
+		toTime, err := parseExportDate(to, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+			return
+		}
+		args = append(args, toTime)
+		where += " AND created_at < $" + strconv.Itoa(len(args))
+	}
+
+	var title string
+	var fields []models.FormField
+	err = h.db.QueryRow(context.Background(), "SELECT title, fields FROM forms WHERE id = $1", formID).Scan(&title, &fields)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Form not found"})
+		return
+	}
+
+	// JSON Lines writes each submission's data as is, so only spreadsheets need columns
+	var columns []exportColumn
+	if format != "jsonl" {
+		fields, err = h.exportFields(fields, where, args)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare export"})
+			return
+		}
+		columns, err = h.exportColumns(fields, where, args)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare export"})
+			return
+		}
+	}
+
+	rows, err := h.db.Query(
+		context.Background(),
+		"SELECT id, form_version, data, created_at FROM form_submissions "+where+" ORDER BY created_at ASC",
+		args...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submissions"})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("form-%d-submissions.%s", formID, format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	// From here on the response is streamed, so failures can only be logged
+	switch format {
+	case "jsonl":
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		encoder := json.NewEncoder(c.Writer)
+		for rows.Next() {
+			var id, version int
+			var data map[string]any
+			var createdAt time.Time
+			if err := rows.Scan(&id, &version, &data, &createdAt); err != nil {
+				log.Printf("Form %d export: failed to scan submission: %v", formID, err)
+				return
+			}
+			line := gin.H{"id": id, "form_version": version, "submitted_at": createdAt.Format(time.RFC3339), "data": data}
+			if err := encoder.Encode(line); err != nil {
+				log.Printf("Form %d export: failed to write submission: %v", formID, err)
+				return
+			}
+		}
+
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		writer := csv.NewWriter(c.Writer)
+		if err := writer.Write(exportHeaders(columns)); err != nil {
+			log.Printf("Form %d export: failed to write header: %v", formID, err)
+			return
+		}
+		count := 0
+		for rows.Next() {
+			record, err := scanExportRecord(rows, columns)
+			if err != nil {
+				log.Printf("Form %d export: failed to scan submission: %v", formID, err)
+				return
+			}
+			for i := range record {
+				record[i] = escapeSpreadsheetFormula(record[i])
+			}
+			if err := writer.Write(record); err != nil {
+				log.Printf("Form %d export: failed to write submission: %v", formID, err)
+				return
+			}
+			count++
+			if count%100 == 0 {
+				writer.Flush()
+			}
+		}
+		writer.Flush()
+
+	case "xlsx":
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Status(http.StatusOK)
+		writer, err := services.NewXLSXStreamWriter(c.Writer, sheetName(title))
+		if err != nil {
+			log.Printf("Form %d export: failed to start workbook: %v", formID, err)
+			return
+		}
+		if err := writer.WriteRow(exportHeaders(columns)); err != nil {
+			log.Printf("Form %d export: failed to write header: %v", formID, err)
+			return
+		}
+		for rows.Next() {
+			record, err := scanExportRecord(rows, columns)
+			if err != nil {
+				log.Printf("Form %d export: failed to scan submission: %v", formID, err)
+				return
+			}
+			if err := writer.WriteRow(record); err != nil {
+				log.Printf("Form %d export: failed to write submission: %v", formID, err)
+				return
+			}
+		}
+		if err := writer.Close(); err != nil {
+			log.Printf("Form %d export: failed to finish workbook: %v", formID, err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Form %d export: error reading submissions: %v", formID, err)
+	}
+}
+
+// exportFields merges the fields of every form version the exported submissions
+// were made against, newest version first, so answers to fields that have since
+// been removed or renamed still get a column. With no submissions it is the
+// form's current fields.
+func (h *FormHandler) exportFields(current []models.FormField, where string, args []any) ([]models.FormField, error) {
+	rows, err := h.db.Query(
+		context.Background(),
+		`SELECT fields FROM form_versions
+		WHERE form_id = $1 AND version IN (SELECT DISTINCT form_version FROM form_submissions `+where+`)
+		ORDER BY version DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fields []models.FormField
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var versionFields []models.FormField
+		if err := rows.Scan(&versionFields); err != nil {
+			return nil, err
+		}
+		for _, field := range versionFields {
+			if !seen[field.Name] {
+				seen[field.Name] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if fields == nil {
+		return current, nil
+	}
+	return fields, nil
+}
+
+// exportColumns builds the column list from the form schema. Fields whose stored
+// answers are objects get one column per nested key, discovered in the database
+// so the submissions never have to be loaded up front.
+func (h *FormHandler) exportColumns(fields []models.FormField, where string, args []any) ([]exportColumn, error) {
+	rows, err := h.db.Query(
+		context.Background(),
+		`SELECT DISTINCT f.key, n.key
+		FROM form_submissions s,
+			jsonb_each(s.data) f,
+			jsonb_each(CASE WHEN jsonb_typeof(f.value) = 'object' THEN f.value ELSE '{}'::jsonb END) n
+		`+where,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nested := make(map[string][]string)
+	for rows.Next() {
+		var field, subKey string
+		if err := rows.Scan(&field, &subKey); err != nil {
+			return nil, err
+		}
+		nested[field] = append(nested[field], subKey)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	columns := []exportColumn{
+		{header: "Submission ID", meta: "id"},
+		{header: "Submitted At", meta: "submitted_at"},
+		{header: "Form Version", meta: "form_version"},
+	}
+	for _, field := range fields {
+		header := field.Label
+		if header == "" {
+			header = field.Name
+		}
+
+		subKeys := nested[field.Name]
+		if len(subKeys) == 0 {
+			columns = append(columns, exportColumn{header: header, field: field.Name})
+			continue
+		}
+		sort.Strings(subKeys)
+		for _, subKey := range subKeys {
+			columns = append(columns, exportColumn{
+				header: header + " (" + subKey + ")",
+				field:  field.Name,
+				subKey: subKey,
+			})
+		}
+	}
+
+	return columns, nil
+}
+
+func exportHeaders(columns []exportColumn) []string {
+	headers := make([]string, len(columns))
+	for i, col := range columns {
+		headers[i] = col.header
+	}
+	return headers
+}
+
+func scanExportRecord(rows pgx.Rows, columns []exportColumn) ([]string, error) {
+	var id, version int
+	var data map[string]any
+	var createdAt time.Time
+	if err := rows.Scan(&id, &version, &data, &createdAt); err != nil {
+		return nil, err
+	}
+
+	record := make([]string, len(columns))
+	for i, col := range columns {
+		switch {
+		case col.meta == "id":
+			record[i] = strconv.Itoa(id)
+		case col.meta == "submitted_at":
+			record[i] = createdAt.Format(time.RFC3339)
+		case col.meta == "form_version":
+			record[i] = strconv.Itoa(version)
+		case col.subKey != "":
+			if obj, ok := data[col.field].(map[string]any); ok {
+				record[i] = formatExportValue(obj[col.subKey])
+			}
+		default:
+			record[i] = formatExportValue(data[col.field])
+		}
+	}
+	return record, nil
+}
+
+// formatExportValue renders an answer as a single spreadsheet cell. Multi-value
+// answers (multi-select, checkbox groups) are joined with semicolons.
+func formatExportValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "Yes"
+		}
+		return "No"
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, formatExportValue(item))
+		}
+		return strings.Join(parts, "; ")
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+}
+
+// exportNumber matches plain decimal numbers, which spreadsheets read as numbers
+// even with a leading sign
+var exportNumber = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// escapeSpreadsheetFormula stops spreadsheet apps from evaluating submitted text
+// as a formula. Numbers such as -5 are left alone so they stay numeric.
+func escapeSpreadsheetFormula(value string) string {
+	if exportNumber.MatchString(value) {
+		return value
+	}
+	if value != "" && strings.ContainsAny(value[:1], "=+-@\t\r") {
+		return "'" + value
+	}
+	return value
+}
+
+// parseExportDate accepts YYYY-MM-DD or RFC3339. A date-only end of range
+// covers the whole day.
+func parseExportDate(value string, endOfRange bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// sheetName trims a form title to Excel's 31 character sheet name limit
+func sheetName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return ' '
+		}
+		return r
+	}, title)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "Submissions"
+	}
+	runes := []rune(name)
+	if len(runes) > 31 {
+		runes = runes[:31]
+	}
+	return string(runes)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/jackc/pgx/v5"
+)
+
+// validateNotifications checks a form's email settings against its fields
+func validateNotifications(n models.FormNotifications, fields []models.FormField) error {
+	for _, addr := range n.AdminRecipients {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("invalid admin recipient: %s", addr)
+		}
+	}
+
+	if !n.SendConfirmation {
+		return nil
+	}
+	if !slices.ContainsFunc(fields, func(f models.FormField) bool {
+		return f.Name == n.ConfirmationField && f.Type == models.FieldTypeEmail
+	}) {
+		return fmt.Errorf("confirmation_field must name an email field")
+	}
+	if strings.TrimSpace(n.ConfirmationSubject) == "" || strings.TrimSpace(n.ConfirmationBody) == "" {
+		return fmt.Errorf("confirmation_subject and confirmation_body are required when send_confirmation is enabled")
+	}
+	for name, text := range map[string]string{"confirmation_subject": n.ConfirmationSubject, "confirmation_body": n.ConfirmationBody} {
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return fmt.Errorf("invalid %s template: %v", name, err)
+		}
+		if field, ok := freeTextTemplateField(tmpl.Tree.Root, fields); ok {
+			return fmt.Errorf("%s can't use %s: confirmation emails only include select, checkbox, number and date answers", name, field)
+		}
+	}
+	return nil
+}
+
+// confirmationFieldTypes are the field types whose answers can appear in a
+// confirmation email. Their values are limited to options, numbers and dates,
+// so the email can't be made to carry a message of the submitter's choosing
+// to whatever address they entered.
+var confirmationFieldTypes = []string{
+	models.FieldTypeSelect, models.FieldTypeCheckbox, models.FieldTypeNumber, models.FieldTypeDate,
+}
+
+// confirmationAnswers keeps the answers a confirmation email may include
+func confirmationAnswers(fields []models.FormField, answers map[string]any) map[string]any {
+	data := make(map[string]any)
+	for _, field := range fields {
+		if value, ok := answers[field.Name]; ok && slices.Contains(confirmationFieldTypes, field.Type) {
+			data[field.Name] = value
+		}
+	}
+	return data
+}
+
+// freeTextTemplateField finds an answer referenced by a template, as {{.name}}
+// or {{$.name}}, that confirmationAnswers would leave out
+func freeTextTemplateField(node parse.Node, fields []models.FormField) (string, bool) {
+	var idents []string
+	var children []parse.Node
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			children = n.Nodes
+		}
+	case *parse.ActionNode:
+		children = []parse.Node{n.Pipe}
+	case *parse.IfNode:
+		children = []parse.Node{n.Pipe, n.List, n.ElseList}
+	case *parse.RangeNode:
+		children = []parse.Node{n.Pipe, n.List, n.ElseList}
+	case *parse.WithNode:
+		children = []parse.Node{n.Pipe, n.List, n.ElseList}
+	case *parse.TemplateNode:
+		children = []parse.Node{n.Pipe}
+	case *parse.PipeNode:
+		if n != nil {
+			for _, cmd := range n.Cmds {
+				children = append(children, cmd)
+			}
+		}
+	case *parse.CommandNode:
+		children = n.Args
+	case *parse.ChainNode:
+		children = []parse.Node{n.Node}
+	case *parse.FieldNode:
+		idents = n.Ident
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			idents = n.Ident[1:]
+		}
+	}
+
+	if len(idents) > 0 {
+		allowed := slices.ContainsFunc(fields, func(f models.FormField) bool {
+			return f.Name == idents[0] && slices.Contains(confirmationFieldTypes, f.Type)
+		})
+		if !allowed {
+			return idents[0], true
+		}
+	}
+	for _, child := range children {
+		if child == nil || reflect.ValueOf(child).IsNil() {
+			continue
+		}
+		if field, ok := freeTextTemplateField(child, fields); ok {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+// enqueueSubmissionEmails queues the admin summary and the submitter's confirmation
+// in the submission's transaction, so emails are only sent for stored submissions.
+// Confirmations count against confirmations per recipient address, so a
+// stranger's address can't be flooded through the form.
+func enqueueSubmissionEmails(ctx context.Context, tx pgx.Tx, title string, submissionID int, fields []models.FormField, n models.FormNotifications, answers map[string]any, confirmations services.RateLimiter) error {
+	if len(n.AdminRecipients) > 0 {
+		var body strings.Builder
+		fmt.Fprintf(&body, "A new response to %q was received (submission #%d).\n\n", title, submissionID)
+		for _, field := range fields {
+			value, ok := answers[field.Name]
+			if !ok {
+				continue
+			}
+			label := field.Label
+			if label == "" {
+				label = field.Name
+			}
+			if field.Type == models.FieldTypeFile {
+				value = uploadedFilenames(value)
+			}
+			fmt.Fprintf(&body, "%s: %s\n", label, formatExportValue(value))
+		}
+
+		subject := "New submission: " + title
+		for _, addr := range n.AdminRecipients {
+			if err := services.EnqueueEmail(ctx, tx, addr, subject, body.String()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if n.SendConfirmation {
+		to, _ := answers[n.ConfirmationField].(string)
+		if to == "" {
+			return nil
+		}
+		if confirmations != nil {
+			if allowed, _ := confirmations.Allow(strings.ToLower(strings.TrimSpace(to))); !allowed {
+				log.Printf("Submission %d: skipping confirmation email: too many sent to this address", submissionID)
+				return nil
+			}
+		}
+		// A template that fails on these answers shouldn't cost the submitter their submission
+		data := confirmationAnswers(fields, answers)
+		subject, err := renderNotificationTemplate(n.ConfirmationSubject, data)
+		if err != nil {
+			log.Printf("Submission %d: skipping confirmation email: %v", submissionID, err)
+			return nil
+		}
+		body, err := renderNotificationTemplate(n.ConfirmationBody, data)
+		if err != nil {
+			log.Printf("Submission %d: skipping confirmation email: %v", submissionID, err)
+			return nil
+		}
+		if err := services.EnqueueEmail(ctx, tx, to, subject, body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renderNotificationTemplate executes a confirmation template. Missing answers
+// render as empty text rather than "<no value>".
+func renderNotificationTemplate(text string, answers map[string]any) (string, error) {
+	tmpl, err := template.New("notification").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid notification template: %v", err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, answers); err != nil {
+		return "", fmt.Errorf("failed to render notification template: %v", err)
+	}
+	return strings.ReplaceAll(out.String(), "<no value>", ""), nil
+}
+
+// uploadedFilenames reduces attached file details to their filenames
+func uploadedFilenames(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return v["filename"]
+	case []any:
+		names := make([]any, 0, len(v))
+		for _, item := range v {
+			names = append(names, uploadedFilenames(item))
+		}
+		return names
+	}
+	return value
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateFormSubmission validates a public submission against the form schema and stores it
+func (h *FormHandler) CreateFormSubmission(c *gin.Context) {
+	formID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form ID"})
+		return
+	}
+
+	var req models.CreateFormSubmissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Validation and the spam checks, which may wait on the rate limit store, run
+	// before the form is locked so they don't hold up other submissions
+	ctx := context.Background()
+	form, err := loadSubmissionForm(ctx, h.db.QueryRow, formID, false)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Form not found"})
+		return
+	}
+	if form.availability != formOpen {
+		c.JSON(http.StatusForbidden, gin.H{"error": formClosedMessage(form.availability, form.closedMessage), "status": form.availability})
+		return
+	}
+
+	cleaned, fieldErrors := validateSubmission(form.fields, form.pages, req.Data)
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fieldErrors})
+		return
+	}
+
+	verdict, ok := evaluateSpam(c, h.spamFilter, submissionSpamInput(c, &req, form.fields, cleaned))
+	if !ok {
+		return
+	}
+	if verdict.IsSpam {
+		log.Printf("Form %d: rejected spam submission from %s (score %.1f: %s)", formID, c.ClientIP(), verdict.Score, strings.Join(verdict.Reasons, "; "))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Submission rejected as spam"})
+		return
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store submission"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the form so concurrent submissions can't overshoot max_responses, and
+	// check it again now that it can't change
+	checkedVersion := form.version
+	form, err = loadSubmissionForm(ctx, tx.QueryRow, formID, true)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Form not found"})
+		return
+	}
+	if form.availability != formOpen {
+		c.JSON(http.StatusForbidden, gin.H{"error": formClosedMessage(form.availability, form.closedMessage), "status": form.availability})
+		return
+	}
+	if form.version != checkedVersion {
+		cleaned, fieldErrors = validateSubmission(form.fields, form.pages, req.Data)
+		if len(fieldErrors) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fieldErrors})
+			return
+		}
+	}
+	// Resolve file answers to the uploads they reference
+	claimed, uploadErrors := attachUploads(ctx, tx, formID, form.fields, cleaned)
+	if len(uploadErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": uploadErrors})
+		return
+	}
+
+	dataBytes, err := json.Marshal(cleaned)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format"})
+		return
+	}
+
+	var id int
+	err = tx.QueryRow(
+		ctx,
+		"INSERT INTO form_submissions (form_id, form_version, data, ip_address, user_agent) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		formID, form.version, string(dataBytes), c.ClientIP(), c.Request.UserAgent(),
+	).Scan(&id)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store submission"})
+		return
+	}
+
+	if len(claimed) > 0 {
+		_, err = tx.Exec(ctx, "UPDATE form_uploads SET submission_id = $1 WHERE id = ANY($2::uuid[])", id, claimed)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store submission"})
+			return
+		}
+	}
+
+	// Emails are delivered by the outbox worker once the submission is committed
+	if err := enqueueSubmissionEmails(ctx, tx, form.title, id, form.fields, form.notifications, cleaned, h.confirmations); err != nil {
+		log.Printf("Form %d: failed to queue notification emails for submission %d: %v", formID, id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store submission"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store submission"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "form_version": form.version, "message": "Submission received"})
+}
+
+// submissionForm is what a submission is checked and stored against
+type submissionForm struct {
+	title, closedMessage, availability string
+	fields                             []models.FormField
+	pages                              []models.FormPage
+	version                            int
+	notifications                      models.FormNotifications
+}
+
+// loadSubmissionForm reads a published form with queryRow, from the pool or a
+// transaction, locking its row when lock is set
+func loadSubmissionForm(ctx context.Context, queryRow func(context.Context, string, ...any) pgx.Row, formID int, lock bool) (submissionForm, error) {
+	query := `SELECT title, fields, pages, current_version, COALESCE(closed_message, ''), notifications, ` + formAvailabilitySQL + `
+		FROM forms WHERE id = $1 AND is_published = true`
+	if lock {
+		query += " FOR UPDATE"
+	}
+	var form submissionForm
+	err := queryRow(ctx, query, formID).Scan(
+		&form.title, &form.fields, &form.pages, &form.version, &form.closedMessage, &form.notifications, &form.availability,
+	)
+	return form, err
+}
+
+// GetFormSubmissions retrieves all submissions for a form (admin only)
+func (h *FormHandler) GetFormSubmissions(c *gin.Context) {
+	formID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form ID"})
+		return
+	}
+
+	rows, err := h.db.Query(
+		context.Background(),
+		`SELECT id, form_id, form_version, data, COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at
+		FROM form_submissions WHERE form_id = $1 ORDER BY created_at DESC`,
+		formID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submissions"})
+		return
+	}
+	defer rows.Close()
+
+	var submissions []models.FormSubmission
+	for rows.Next() {
+		var submission models.FormSubmission
+		if err := rows.Scan(
+			&submission.ID, &submission.FormID, &submission.FormVersion, &submission.Data,
+			&submission.IPAddress, &submission.UserAgent, &submission.CreatedAt,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan submission"})
+			return
+		}
+		submissions = append(submissions, submission)
+	}
+
+	if submissions == nil {
+		submissions = []models.FormSubmission{}
+	}
+
+	c.JSON(http.StatusOK, submissions)
+}
+
+// GetFormSubmissionByID retrieves a single submission (admin only)
+func (h *FormHandler) GetFormSubmissionByID(c *gin.Context) {
+	formID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form ID"})
+		return
+	}
+	submissionID, err := strconv.Atoi(c.Param("submission_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	var submission models.FormSubmission
+	err = h.db.QueryRow(
+		context.Background(),
+		`SELECT id, form_id, form_version, data, COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at
+		FROM form_submissions WHERE id = $1 AND form_id = $2`,
+		submissionID, formID,
+	).Scan(
+		&submission.ID, &submission.FormID, &submission.FormVersion, &submission.Data,
+		&submission.IPAddress, &submission.UserAgent, &submission.CreatedAt,
+	)
+
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, submission)
+}
+
+// DeleteFormSubmission deletes a submission (admin only)
+func (h *FormHandler) DeleteFormSubmission(c *gin.Context) {
+	formID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form ID"})
+		return
+	}
+	submissionID, err := strconv.Atoi(c.Param("submission_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	keys, err := h.uploadObjectKeys(
+		"SELECT object_key FROM form_uploads WHERE submission_id = $1 AND form_id = $2",
+		submissionID, formID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete submission"})
+		return
+	}
+
+	deleted, err := execAudited(
+		c, h.db, models.AuditActionDelete, models.AuditResourceFormSubmission, submissionID,
+		"DELETE FROM form_submissions WHERE id = $1 AND form_id = $2",
+		submissionID, formID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete submission"})
+		return
+	}
+
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+		return
+	}
+
+	// Uploaded files go with the submission
+	h.deleteUploadObjects(keys)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Submission deleted successfully"})
+}
+
+// submissionSpamInput collects the text answers and first email answer for the spam checks
+func submissionSpamInput(c *gin.Context, req *models.CreateFormSubmissionRequest, fields []models.FormField, answers map[string]any) services.SpamSubmission {
+	sub := services.SpamSubmission{
+		IP:          c.ClientIP(),
+		Honeypot:    req.Website,
+		Token:       req.SpamToken,
+		ProofOfWork: req.PowNonce,
+	}
+
+	var content []string
+	for _, field := range fields {
+		value, ok := answers[field.Name].(string)
+		if !ok {
+			continue
+		}
+		if field.Type == models.FieldTypeEmail && sub.Email == "" {
+			sub.Email = value
+		}
+		if field.Type == models.FieldTypeText {
+			content = append(content, value)
+		}
+	}
+	sub.Content = strings.Join(content, "\n")
+
+	return sub
+}
+
+// formClosedMessage is the message shown to respondents when a form isn't accepting responses
+func formClosedMessage(availability, closedMessage string) string {
+	if closedMessage != "" {
+		return closedMessage
+	}
+	switch availability {
+	case formNotOpen:
+		return "This form is not open yet"
+	case formFull:
+		return "This form has reached its maximum number of responses"
+	}
+	return "This form is closed"
+}
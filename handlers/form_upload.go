@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultFormFileSize = 10 * 1024 * 1024
+	maxFormFileSize     = 25 * 1024 * 1024
+
+	// How long an admin download link stays valid
+	formFileURLExpiry = 15 * time.Minute
+)
+
+// formFileContentTypes lists the file extensions a form file field may accept
+var formFileContentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".txt":  "text/plain",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// formFileSniffTypes is what http.DetectContentType reports for each extension,
+// so a renamed executable can't pass as a PDF. Office files are checked by
+// formFileMatchesOffice instead, since the sniffer only sees them as generic
+// binary or zip data.
+var formFileSniffTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".txt":  "text/plain",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// oleMagic starts every OLE2 compound file, the container of .doc and .xls
+var oleMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// officeZipParts are the zip entries an Office Open XML file of each extension
+// must contain: the package's content types and the document's main part
+var officeZipParts = map[string][]string{
+	".docx": {"[Content_Types].xml", "word/document.xml"},
+	".xlsx": {"[Content_Types].xml", "xl/workbook.xml"},
+}
+
+var defaultFormFileTypes = []string{".pdf", ".doc", ".docx", ".jpg", ".jpeg", ".png"}
+
+// UploadFormFile stores a file for one of a published form's file fields. The returned
+// upload ID is then sent as that field's answer in the submission.
+func (h *FormHandler) UploadFormFile(c *gin.Context) {
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "File upload service is not available. Storage is not configured.",
+		})
+		return
+	}
+
+	formID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form ID"})
+		return
+	}
+
+	var fields []models.FormField
+	var closedMessage, availability string
+	err = h.db.QueryRow(
+		context.Background(),
+		`SELECT fields, COALESCE(closed_message, ''), `+formAvailabilitySQL+`
+		FROM forms WHERE id = $1 AND is_published = true`,
+		formID,
+	).Scan(&fields, &closedMessage, &availability)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Form not found"})
+		return
+	}
+
+	if availability != formOpen {
+		c.JSON(http.StatusForbidden, gin.H{"error": formClosedMessage(availability, closedMessage), "status": availability})
+		return
+	}
+
+	fieldName := c.PostForm("field")
+	idx := slices.IndexFunc(fields, func(f models.FormField) bool {
+		return f.Name == fieldName && f.Type == models.FieldTypeFile
+	})
+	if idx < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown file field"})
+		return
+	}
+	field := fields[idx]
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return
+	}
+	defer file.Close()
+
+	allowed := field.AllowedTypes
+	if len(allowed) == 0 {
+		allowed = defaultFormFileTypes
+	}
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if !slices.Contains(allowed, ext) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File type not allowed", "allowed_types": allowed})
+		return
+	}
+
+	maxSize := field.MaxFileSize
+	if maxSize == 0 {
+		maxSize = defaultFormFileSize
+	}
+	if header.Size > maxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File too large: maximum %d bytes allowed", maxSize)})
+		return
+	}
+
+	// Check the content matches the extension
+	head := make([]byte, 512)
+	n, _ := file.Read(head)
+	matches := strings.HasPrefix(http.DetectContentType(head[:n]), formFileSniffTypes[ext])
+	switch ext {
+	case ".doc", ".xls", ".docx", ".xlsx":
+		matches = formFileMatchesOffice(file, header.Size, head[:n], ext)
+	}
+	if !matches {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File content does not match its type"})
+		return
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	uploadID := uuid.New().String()
+	objectKey := fmt.Sprintf("forms/%d/%s%s", formID, uploadID, ext)
+	contentType := formFileContentTypes[ext]
+
+	if err := h.storage.PutPrivate(context.Background(), objectKey, file, header.Size, contentType); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
+		return
+	}
+
+	_, err = h.db.Exec(
+		context.Background(),
+		`INSERT INTO form_uploads (id, form_id, field_name, object_key, filename, content_type, size_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		uploadID, formID, field.Name, objectKey, filepath.Base(header.Filename), contentType, header.Size,
+	)
+	if err != nil {
+		if deleteErr := h.storage.Delete(context.Background(), objectKey); deleteErr != nil {
+			log.Printf("Failed to clean up form upload %s: %v", objectKey, deleteErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store upload"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"upload_id": uploadID, "filename": filepath.Base(header.Filename)})
+}
+
+// GetSubmissionFileURL returns a short-lived download link for a submitted file (admin only)
+func (h *FormHandler) GetSubmissionFileURL(c *gin.Context) {
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "File upload service is not available. Storage is not configured.",
+		})
+		return
+	}
+
+	formID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form ID"})
+		return
+	}
+	submissionID, err := strconv.Atoi(c.Param("submission_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+	uploadID, err := uuid.Parse(c.Param("upload_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload ID"})
+		return
+	}
+
+	var objectKey, filename string
+	err = h.db.QueryRow(
+		context.Background(),
+		"SELECT object_key, filename FROM form_uploads WHERE id = $1 AND form_id = $2 AND submission_id = $3",
+		uploadID.String(), formID, submissionID,
+	).Scan(&objectKey, &filename)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	url, err := h.storage.SignedURL(context.Background(), objectKey, formFileURLExpiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate download link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"url":        url,
+		"filename":   filename,
+		"expires_at": time.Now().Add(formFileURLExpiry),
+	})
+}
+
+// attachUploads swaps upload IDs in file answers for file details and claims the
+// uploads for the submission. It must run in the submission's transaction.
+func attachUploads(ctx context.Context, tx pgx.Tx, formID int, fields []models.FormField, answers map[string]any) ([]string, map[string]string) {
+	var claimed []string
+	errs := make(map[string]string)
+
+	for _, field := range fields {
+		if field.Type != models.FieldTypeFile {
+			continue
+		}
+		value, ok := answers[field.Name]
+		if !ok {
+			continue
+		}
+
+		var ids []string
+		switch v := value.(type) {
+		case string:
+			ids = []string{v}
+		case []string:
+			ids = v
+		}
+
+		files := make([]any, 0, len(ids))
+		for _, id := range ids {
+			var upload models.FormUpload
+			err := tx.QueryRow(
+				ctx,
+				`SELECT id, filename, content_type, size_bytes FROM form_uploads
+				WHERE id = $1 AND form_id = $2 AND field_name = $3 AND submission_id IS NULL
+				FOR UPDATE`,
+				id, formID, field.Name,
+			).Scan(&upload.ID, &upload.Filename, &upload.ContentType, &upload.SizeBytes)
+			if err != nil {
+				errs[field.Name] = "Uploaded file not found or already used"
+				break
+			}
+			claimed = append(claimed, upload.ID)
+			files = append(files, map[string]any{
+				"upload_id":    upload.ID,
+				"filename":     upload.Filename,
+				"content_type": upload.ContentType,
+				"size_bytes":   upload.SizeBytes,
+			})
+		}
+
+		if field.Multiple {
+			answers[field.Name] = files
+		} else if len(files) == 1 {
+			answers[field.Name] = files[0]
+		}
+	}
+
+	return claimed, errs
+}
+
+// CleanupOrphanedUploads removes uploads never attached to a submission, for example
+// when the respondent abandoned the form. It returns the number removed.
+func (h *FormHandler) CleanupOrphanedUploads(olderThan time.Duration) (int, error) {
+	if h.storage == nil {
+		return 0, nil
+	}
+
+	// Deleting the rows first means an upload can't be claimed while its file is removed
+	keys, err := h.uploadObjectKeys(
+		"DELETE FROM form_uploads WHERE submission_id IS NULL AND created_at < $1 RETURNING object_key",
+		time.Now().Add(-olderThan),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove orphaned uploads: %v", err)
+	}
+
+	h.deleteUploadObjects(keys)
+	return len(keys), nil
+}
+
+// uploadObjectKeys runs a query returning object_key values
+func (h *FormHandler) uploadObjectKeys(query string, args ...any) ([]string, error) {
+	rows, err := h.db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// deleteUploadObjects removes stored files whose rows have been deleted
+func (h *FormHandler) deleteUploadObjects(keys []string) {
+	if h.storage == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := h.storage.Delete(context.Background(), key); err != nil {
+			log.Printf("Failed to delete form upload %s: %v", key, err)
+		}
+	}
+}
+
+// formFileMatchesOffice checks an Office file's structure: the OLE2 signature for
+// .doc and .xls, and for .docx and .xlsx a zip holding the parts of that kind of
+// document rather than any zip
+func formFileMatchesOffice(file io.ReaderAt, size int64, head []byte, ext string) bool {
+	parts, ok := officeZipParts[ext]
+	if !ok {
+		return bytes.HasPrefix(head, oleMagic)
+	}
+
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		return false
+	}
+	for _, part := range parts {
+		if !slices.ContainsFunc(archive.File, func(f *zip.File) bool { return f.Name == part }) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,468 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/google/uuid"
+)
+
+var fieldNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// validateFormSchema checks that a form's fields and pages are well formed before they are stored
+func validateFormSchema(fields []models.FormField, pages []models.FormPage) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("form must define at least one field")
+	}
+
+	pageIndex := make(map[string]models.FormPage)
+	for _, page := range pages {
+		if page.ID == "" {
+			return fmt.Errorf("page id is required")
+		}
+		if _, ok := pageIndex[page.ID]; ok {
+			return fmt.Errorf("duplicate page id: %s", page.ID)
+		}
+		pageIndex[page.ID] = page
+	}
+
+	fieldIndex := make(map[string]models.FormField)
+	for _, field := range fields {
+		if !fieldNamePattern.MatchString(field.Name) {
+			return fmt.Errorf("invalid field name: %q", field.Name)
+		}
+		if _, ok := fieldIndex[field.Name]; ok {
+			return fmt.Errorf("duplicate field name: %s", field.Name)
+		}
+		fieldIndex[field.Name] = field
+
+		switch field.Type {
+		case models.FieldTypeText, models.FieldTypeEmail, models.FieldTypeNumber,
+			models.FieldTypeCheckbox, models.FieldTypeDate:
+		case models.FieldTypeSelect:
+			if len(field.Options) == 0 {
+				return fmt.Errorf("select field %s must define options", field.Name)
+			}
+		case models.FieldTypeFile:
+			for _, ext := range field.AllowedTypes {
+				if _, ok := formFileContentTypes[strings.ToLower(ext)]; !ok {
+					return fmt.Errorf("unsupported file type %q for field %s", ext, field.Name)
+				}
+			}
+			if field.MaxFileSize < 0 || field.MaxFileSize > maxFormFileSize {
+				return fmt.Errorf("field %s max_file_size must be at most %d bytes", field.Name, maxFormFileSize)
+			}
+		default:
+			return fmt.Errorf("unsupported type %q for field %s", field.Type, field.Name)
+		}
+
+		if field.Min != nil && field.Max != nil && *field.Min > *field.Max {
+			return fmt.Errorf("field %s has min greater than max", field.Name)
+		}
+		if field.MinLength != nil && field.MaxLength != nil && *field.MinLength > *field.MaxLength {
+			return fmt.Errorf("field %s has min_length greater than max_length", field.Name)
+		}
+
+		if len(pages) > 0 {
+			if _, ok := pageIndex[field.Page]; !ok {
+				return fmt.Errorf("field %s must be assigned to a defined page", field.Name)
+			}
+		} else if field.Page != "" {
+			return fmt.Errorf("field %s references page %s but the form has no pages", field.Name, field.Page)
+		}
+	}
+
+	for _, page := range pages {
+		if err := validateConditions(page.ShowIf, fieldIndex); err != nil {
+			return fmt.Errorf("page %s: %v", page.ID, err)
+		}
+	}
+	for _, field := range fields {
+		if err := validateConditions(field.ShowIf, fieldIndex); err != nil {
+			return fmt.Errorf("field %s: %v", field.Name, err)
+		}
+	}
+
+	// Reject rules that depend on themselves, directly or through other fields
+	state := make(map[string]int) // 0 unvisited, 1 in progress, 2 done
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("show_if rules form a cycle through field %s", name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, dep := range conditionDependencies(fieldIndex[name], pageIndex) {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	for _, field := range fields {
+		if err := visit(field.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateConditions(conditions []models.FieldCondition, fieldIndex map[string]models.FormField) error {
+	for _, cond := range conditions {
+		if _, ok := fieldIndex[cond.Field]; !ok {
+			return fmt.Errorf("show_if references unknown field %s", cond.Field)
+		}
+		switch cond.Operator {
+		case models.ConditionEquals, models.ConditionNotEquals, models.ConditionContains:
+		case models.ConditionGreaterThan, models.ConditionLessThan:
+			switch cond.Value.(type) {
+			case float64, string:
+			default:
+				return fmt.Errorf("%s on %s needs a number or date value", cond.Operator, cond.Field)
+			}
+		default:
+			return fmt.Errorf("unsupported show_if operator %q", cond.Operator)
+		}
+	}
+	return nil
+}
+
+// conditionDependencies lists the fields a field's visibility depends on
+func conditionDependencies(field models.FormField, pageIndex map[string]models.FormPage) []string {
+	var deps []string
+	for _, cond := range field.ShowIf {
+		deps = append(deps, cond.Field)
+	}
+	if page, ok := pageIndex[field.Page]; ok {
+		for _, cond := range page.ShowIf {
+			deps = append(deps, cond.Field)
+		}
+	}
+	return deps
+}
+
+// validateSubmission checks submitted answers against the form schema. Fields hidden
+// by show_if rules (on the field or its page) are neither required nor stored. It
+// returns the cleaned answers and a map of field name to error message.
+func validateSubmission(fields []models.FormField, pages []models.FormPage, data map[string]any) (map[string]any, map[string]string) {
+	cleaned := make(map[string]any)
+	errs := make(map[string]string)
+	resolver := newVisibilityResolver(fields, pages, data)
+
+	for _, field := range fields {
+		if !resolver.fieldVisible(field.Name) {
+			continue
+		}
+
+		value, present := data[field.Name]
+		if !present || isEmptyValue(value) {
+			if field.Required {
+				errs[field.Name] = "This field is required"
+			}
+			continue
+		}
+
+		normalized, err := validateFieldValue(field, value)
+		if err != nil {
+			errs[field.Name] = err.Error()
+			continue
+		}
+		cleaned[field.Name] = normalized
+	}
+
+	return cleaned, errs
+}
+
+// visibilityResolver evaluates show_if rules against a submission. A rule that
+// references a hidden field sees that field as unanswered.
+type visibilityResolver struct {
+	fields map[string]models.FormField
+	pages  map[string]models.FormPage
+	data   map[string]any
+	memo   map[string]bool
+}
+
+func newVisibilityResolver(fields []models.FormField, pages []models.FormPage, data map[string]any) *visibilityResolver {
+	r := &visibilityResolver{
+		fields: make(map[string]models.FormField),
+		pages:  make(map[string]models.FormPage),
+		data:   data,
+		memo:   make(map[string]bool),
+	}
+	for _, field := range fields {
+		r.fields[field.Name] = field
+	}
+	for _, page := range pages {
+		r.pages[page.ID] = page
+	}
+	return r
+}
+
+func (r *visibilityResolver) fieldVisible(name string) bool {
+	if visible, ok := r.memo[name]; ok {
+		return visible
+	}
+	field, ok := r.fields[name]
+	if !ok {
+		return false
+	}
+
+	// Mark as hidden while resolving so a cyclic rule can never recurse forever
+	r.memo[name] = false
+
+	visible := true
+	if page, ok := r.pages[field.Page]; ok {
+		visible = r.conditionsMet(page.ShowIf)
+	}
+	if visible {
+		visible = r.conditionsMet(field.ShowIf)
+	}
+
+	r.memo[name] = visible
+	return visible
+}
+
+func (r *visibilityResolver) conditionsMet(conditions []models.FieldCondition) bool {
+	for _, cond := range conditions {
+		var actual any
+		if r.fieldVisible(cond.Field) {
+			actual = r.data[cond.Field]
+		}
+		if !evaluateCondition(cond, actual) {
+			return false
+		}
+	}
+	return true
+}
+
+func evaluateCondition(cond models.FieldCondition, actual any) bool {
+	switch cond.Operator {
+	case models.ConditionEquals:
+		return conditionValuesEqual(actual, cond.Value)
+	case models.ConditionNotEquals:
+		return !conditionValuesEqual(actual, cond.Value)
+	case models.ConditionContains:
+		switch v := actual.(type) {
+		case string:
+			expected, ok := cond.Value.(string)
+			return ok && strings.Contains(strings.ToLower(v), strings.ToLower(expected))
+		case []any:
+			for _, item := range v {
+				if conditionValuesEqual(item, cond.Value) {
+					return true
+				}
+			}
+		}
+		return false
+	case models.ConditionGreaterThan, models.ConditionLessThan:
+		cmp, ok := compareConditionValues(actual, cond.Value)
+		if !ok {
+			return false
+		}
+		if cond.Operator == models.ConditionGreaterThan {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	return false
+}
+
+func conditionValuesEqual(actual, expected any) bool {
+	switch a := actual.(type) {
+	case string:
+		e, ok := expected.(string)
+		return ok && a == e
+	case float64:
+		e, ok := expected.(float64)
+		return ok && a == e
+	case bool:
+		e, ok := expected.(bool)
+		return ok && a == e
+	case nil:
+		return expected == nil
+	}
+	return false
+}
+
+// compareConditionValues compares numbers numerically and strings (YYYY-MM-DD dates) lexically
+func compareConditionValues(actual, expected any) (int, bool) {
+	switch a := actual.(type) {
+	case float64:
+		e, ok := expected.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a > e:
+			return 1, true
+		case a < e:
+			return -1, true
+		}
+		return 0, true
+	case string:
+		e, ok := expected.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, e), true
+	}
+	return 0, false
+}
+
+func validateFieldValue(field models.FormField, value any) (any, error) {
+	switch field.Type {
+	case models.FieldTypeText:
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a string")
+		}
+		length := len([]rune(str))
+		if field.MinLength != nil && length < *field.MinLength {
+			return nil, fmt.Errorf("must be at least %d characters", *field.MinLength)
+		}
+		if field.MaxLength != nil && length > *field.MaxLength {
+			return nil, fmt.Errorf("must be at most %d characters", *field.MaxLength)
+		}
+		return str, nil
+
+	case models.FieldTypeEmail:
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a string")
+		}
+		str = strings.TrimSpace(str)
+		addr, err := mail.ParseAddress(str)
+		if err != nil || addr.Address != str {
+			return nil, fmt.Errorf("must be a valid email address")
+		}
+		return str, nil
+
+	case models.FieldTypeNumber:
+		num, ok := value.(float64)
+		if !ok || math.IsNaN(num) || math.IsInf(num, 0) {
+			return nil, fmt.Errorf("must be a number")
+		}
+		if field.Min != nil && num < *field.Min {
+			return nil, fmt.Errorf("must be at least %v", *field.Min)
+		}
+		if field.Max != nil && num > *field.Max {
+			return nil, fmt.Errorf("must be at most %v", *field.Max)
+		}
+		return num, nil
+
+	case models.FieldTypeSelect:
+		if field.Multiple {
+			selected, err := stringList(value)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range selected {
+				if !slices.Contains(field.Options, s) {
+					return nil, fmt.Errorf("invalid option: %s", s)
+				}
+			}
+			return selected, nil
+		}
+		str, ok := value.(string)
+		if !ok || !slices.Contains(field.Options, str) {
+			return nil, fmt.Errorf("must be one of the available options")
+		}
+		return str, nil
+
+	case models.FieldTypeCheckbox:
+		// A checkbox with options is a group of choices; without options it is a single boolean
+		if len(field.Options) > 0 {
+			selected, err := stringList(value)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range selected {
+				if !slices.Contains(field.Options, s) {
+					return nil, fmt.Errorf("invalid option: %s", s)
+				}
+			}
+			return selected, nil
+		}
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		if field.Required && !b {
+			return nil, fmt.Errorf("must be checked")
+		}
+		return b, nil
+
+	case models.FieldTypeDate:
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a date string")
+		}
+		if _, err := time.Parse("2006-01-02", str); err != nil {
+			return nil, fmt.Errorf("must be a date in YYYY-MM-DD format")
+		}
+		return str, nil
+
+	case models.FieldTypeFile:
+		// Answers reference uploads by ID; they are resolved against form_uploads on submit
+		if field.Multiple {
+			ids, err := stringList(value)
+			if err != nil {
+				return nil, fmt.Errorf("must be a list of uploaded files")
+			}
+			for _, id := range ids {
+				if _, err := uuid.Parse(id); err != nil {
+					return nil, fmt.Errorf("invalid upload reference")
+				}
+			}
+			return ids, nil
+		}
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be an uploaded file")
+		}
+		if _, err := uuid.Parse(str); err != nil {
+			return nil, fmt.Errorf("invalid upload reference")
+		}
+		return str, nil
+	}
+
+	return nil, fmt.Errorf("unsupported field type")
+}
+
+func stringList(value any) ([]string, error) {
+	items, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("must be a list of options")
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a list of options")
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+func isEmptyValue(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
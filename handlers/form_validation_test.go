@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aslotsu/monkreflections-form-api/models"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestValidateFieldValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		field models.FormField
+		value any
+		want  any // nil when the value is refused
+	}{
+		{"text", models.FormField{Type: models.FieldTypeText}, "hello", "hello"},
+		{"text that isn't a string", models.FormField{Type: models.FieldTypeText}, 5.0, nil},
+		{"text at max length in characters", models.FormField{Type: models.FieldTypeText, MaxLength: ptr(3)}, "héé", "héé"},
+		{"text over max length", models.FormField{Type: models.FieldTypeText, MaxLength: ptr(3)}, "four", nil},
+		{"text under min length", models.FormField{Type: models.FieldTypeText, MinLength: ptr(2)}, "a", nil},
+		{"email", models.FormField{Type: models.FieldTypeEmail}, " someone@example.com ", "someone@example.com"},
+		{"email with a display name", models.FormField{Type: models.FieldTypeEmail}, "Someone <someone@example.com>", nil},
+		{"email without a domain", models.FormField{Type: models.FieldTypeEmail}, "someone", nil},
+		{"number", models.FormField{Type: models.FieldTypeNumber}, -5.0, -5.0},
+		{"number as a string", models.FormField{Type: models.FieldTypeNumber}, "5", nil},
+		{"number at min", models.FormField{Type: models.FieldTypeNumber, Min: ptr(1.0)}, 1.0, 1.0},
+		{"number under min", models.FormField{Type: models.FieldTypeNumber, Min: ptr(1.0)}, 0.5, nil},
+		{"number over max", models.FormField{Type: models.FieldTypeNumber, Max: ptr(10.0)}, 10.5, nil},
+		{"select", models.FormField{Type: models.FieldTypeSelect, Options: []string{"a", "b"}}, "b", "b"},
+		{"select outside the options", models.FormField{Type: models.FieldTypeSelect, Options: []string{"a", "b"}}, "c", nil},
+		{"select list without multiple", models.FormField{Type: models.FieldTypeSelect, Options: []string{"a"}}, []any{"a"}, nil},
+		{"multiple select", models.FormField{Type: models.FieldTypeSelect, Options: []string{"a", "b"}, Multiple: true}, []any{"a", "b"}, []string{"a", "b"}},
+		{"multiple select outside the options", models.FormField{Type: models.FieldTypeSelect, Options: []string{"a"}, Multiple: true}, []any{"a", "z"}, nil},
+		{"multiple select with a non-string", models.FormField{Type: models.FieldTypeSelect, Options: []string{"a"}, Multiple: true}, []any{"a", 1.0}, nil},
+		{"checkbox", models.FormField{Type: models.FieldTypeCheckbox}, false, false},
+		{"required checkbox unchecked", models.FormField{Type: models.FieldTypeCheckbox, Required: true}, false, nil},
+		{"checkbox as a string", models.FormField{Type: models.FieldTypeCheckbox}, "true", nil},
+		{"checkbox group", models.FormField{Type: models.FieldTypeCheckbox, Options: []string{"x", "y"}}, []any{"y"}, []string{"y"}},
+		{"checkbox group as a boolean", models.FormField{Type: models.FieldTypeCheckbox, Options: []string{"x"}}, true, nil},
+		{"date", models.FormField{Type: models.FieldTypeDate}, "2026-02-28", "2026-02-28"},
+		{"impossible date", models.FormField{Type: models.FieldTypeDate}, "2026-02-30", nil},
+		{"date with a time", models.FormField{Type: models.FieldTypeDate}, "2026-02-28T10:00:00Z", nil},
+		{"file", models.FormField{Type: models.FieldTypeFile}, "3f1c2a9e-6b7d-4c1e-9a51-2d0f8e7b6c45", "3f1c2a9e-6b7d-4c1e-9a51-2d0f8e7b6c45"},
+		{"file that isn't an upload ID", models.FormField{Type: models.FieldTypeFile}, "../../etc/passwd", nil},
+		{"multiple files with a bad ID", models.FormField{Type: models.FieldTypeFile, Multiple: true}, []any{"3f1c2a9e-6b7d-4c1e-9a51-2d0f8e7b6c45", "x"}, nil},
+		{"unknown type", models.FormField{Type: "color"}, "red", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateFieldValue(tt.field, tt.value)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("accepted %v as %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("refused: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// showIfForm asks whether the respondent is attending; the diet question and
+// the travel page only apply to attendees, and the hotel question only to
+// attendees coming from more than 100km away
+func showIfForm() ([]models.FormField, []models.FormPage) {
+	attending := []models.FieldCondition{{Field: "attending", Operator: models.ConditionEquals, Value: "yes"}}
+	pages := []models.FormPage{
+		{ID: "rsvp"},
+		{ID: "travel", ShowIf: attending},
+	}
+	fields := []models.FormField{
+		{Name: "attending", Type: models.FieldTypeSelect, Options: []string{"yes", "no"}, Required: true, Page: "rsvp"},
+		{Name: "diet", Type: models.FieldTypeCheckbox, Options: []string{"vegan", "halal"}, Page: "rsvp", ShowIf: attending},
+		{Name: "distance", Type: models.FieldTypeNumber, Required: true, Page: "travel"},
+		{Name: "hotel", Type: models.FieldTypeCheckbox, Required: true, Page: "travel", ShowIf: []models.FieldCondition{
+			{Field: "distance", Operator: models.ConditionGreaterThan, Value: 100.0},
+		}},
+	}
+	return fields, pages
+}
+
+func TestValidateSubmissionShowIf(t *testing.T) {
+	fields, pages := showIfForm()
+
+	tests := []struct {
+		name    string
+		data    map[string]any
+		cleaned map[string]any
+		errs    []string // fields with errors
+	}{
+		{
+			name:    "not attending skips the rest",
+			data:    map[string]any{"attending": "no"},
+			cleaned: map[string]any{"attending": "no"},
+		},
+		{
+			name:    "answers to hidden fields are dropped",
+			data:    map[string]any{"attending": "no", "diet": []any{"vegan"}, "distance": 500.0, "hotel": true},
+			cleaned: map[string]any{"attending": "no"},
+		},
+		{
+			name:    "attending nearby",
+			data:    map[string]any{"attending": "yes", "diet": []any{"halal"}, "distance": 20.0},
+			cleaned: map[string]any{"attending": "yes", "diet": []string{"halal"}, "distance": 20.0},
+		},
+		{
+			name: "attending from far away needs the hotel answer",
+			data: map[string]any{"attending": "yes", "distance": 250.0},
+			errs: []string{"hotel"},
+		},
+		{
+			name:    "attending from far away",
+			data:    map[string]any{"attending": "yes", "distance": 250.0, "hotel": true},
+			cleaned: map[string]any{"attending": "yes", "distance": 250.0, "hotel": true},
+		},
+		{
+			name: "the travel page is required for attendees",
+			data: map[string]any{"attending": "yes"},
+			errs: []string{"distance"},
+		},
+		{
+			name: "a distance that isn't a number hides the hotel question",
+			data: map[string]any{"attending": "yes", "distance": "far"},
+			errs: []string{"distance"},
+		},
+		{
+			name: "nothing answered",
+			data: map[string]any{},
+			errs: []string{"attending"},
+		},
+		{
+			name: "blank answers count as missing",
+			data: map[string]any{"attending": "   "},
+			errs: []string{"attending"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleaned, errs := validateSubmission(fields, pages, tt.data)
+			var errFields []string
+			for _, field := range fields {
+				if _, ok := errs[field.Name]; ok {
+					errFields = append(errFields, field.Name)
+				}
+			}
+			if !reflect.DeepEqual(errFields, tt.errs) {
+				t.Fatalf("errors on %v, want %v: %v", errFields, tt.errs, errs)
+			}
+			if tt.errs == nil && !reflect.DeepEqual(cleaned, tt.cleaned) {
+				t.Errorf("cleaned to %#v, want %#v", cleaned, tt.cleaned)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator string
+		value    any
+		actual   any
+		want     bool
+	}{
+		{"equals string", models.ConditionEquals, "yes", "yes", true},
+		{"equals is case sensitive", models.ConditionEquals, "yes", "Yes", false},
+		{"equals number", models.ConditionEquals, 3.0, 3.0, true},
+		{"equals across types", models.ConditionEquals, "3", 3.0, false},
+		{"equals boolean", models.ConditionEquals, true, true, true},
+		{"equals nil for unanswered", models.ConditionEquals, nil, nil, true},
+		{"not equals unanswered", models.ConditionNotEquals, "yes", nil, true},
+		{"contains substring, ignoring case", models.ConditionContains, "LOW", "yellow", true},
+		{"contains list item", models.ConditionContains, "b", []any{"a", "b"}, true},
+		{"contains missing list item", models.ConditionContains, "c", []any{"a", "b"}, false},
+		{"contains on a number", models.ConditionContains, "1", 1.0, false},
+		{"greater than", models.ConditionGreaterThan, 10.0, 10.5, true},
+		{"greater than when equal", models.ConditionGreaterThan, 10.0, 10.0, false},
+		{"less than date", models.ConditionLessThan, "2026-06-01", "2026-05-31", true},
+		{"greater than across types", models.ConditionGreaterThan, 10.0, "11", false},
+		{"less than unanswered", models.ConditionLessThan, 10.0, nil, false},
+		{"unknown operator", "matches", ".*", "anything", false},
+	}
+	for _, tt := range tests {
+		cond := models.FieldCondition{Field: "f", Operator: tt.operator, Value: tt.value}
+		if got := evaluateCondition(cond, tt.actual); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateFormSchema(t *testing.T) {
+	validFields, validPages := showIfForm()
+
+	text := func(name string, showIf ...models.FieldCondition) models.FormField {
+		return models.FormField{Name: name, Type: models.FieldTypeText, ShowIf: showIf}
+	}
+	answered := func(field string) models.FieldCondition {
+		return models.FieldCondition{Field: field, Operator: models.ConditionNotEquals, Value: nil}
+	}
+
+	tests := []struct {
+		name   string
+		fields []models.FormField
+		pages  []models.FormPage
+		err    string // empty when the schema is valid
+	}{
+		{"valid", validFields, validPages, ""},
+		{"no fields", nil, nil, "at least one field"},
+		{"bad field name", []models.FormField{text("1st")}, nil, "invalid field name"},
+		{"duplicate field", []models.FormField{text("a"), text("a")}, nil, "duplicate field name"},
+		{"select without options", []models.FormField{{Name: "a", Type: models.FieldTypeSelect}}, nil, "must define options"},
+		{"unknown file type", []models.FormField{{Name: "a", Type: models.FieldTypeFile, AllowedTypes: []string{".exe"}}}, nil, "unsupported file type"},
+		{"file size over the limit", []models.FormField{{Name: "a", Type: models.FieldTypeFile, MaxFileSize: maxFormFileSize + 1}}, nil, "max_file_size"},
+		{"min over max", []models.FormField{{Name: "a", Type: models.FieldTypeNumber, Min: ptr(2.0), Max: ptr(1.0)}}, nil, "min greater than max"},
+		{"field on an undefined page", []models.FormField{{Name: "a", Type: models.FieldTypeText, Page: "p2"}}, []models.FormPage{{ID: "p1"}}, "defined page"},
+		{"page without pages", []models.FormField{{Name: "a", Type: models.FieldTypeText, Page: "p1"}}, nil, "has no pages"},
+		{"duplicate page", []models.FormField{{Name: "a", Type: models.FieldTypeText, Page: "p"}}, []models.FormPage{{ID: "p"}, {ID: "p"}}, "duplicate page id"},
+		{"condition on an unknown field", []models.FormField{text("a", answered("b"))}, nil, "unknown field b"},
+		{"unknown operator", []models.FormField{text("a"), text("b", models.FieldCondition{Field: "a", Operator: "matches"})}, nil, "unsupported show_if operator"},
+		{"comparison with a boolean", []models.FormField{text("a"), text("b", models.FieldCondition{Field: "a", Operator: models.ConditionGreaterThan, Value: true})}, nil, "number or date value"},
+		{"field depending on itself", []models.FormField{text("a", answered("a"))}, nil, "cycle"},
+		{"cycle through two fields", []models.FormField{text("a", answered("b")), text("b", answered("a"))}, nil, "cycle"},
+		{
+			"cycle through a page",
+			[]models.FormField{
+				{Name: "a", Type: models.FieldTypeText, Page: "p1", ShowIf: []models.FieldCondition{answered("b")}},
+				{Name: "b", Type: models.FieldTypeText, Page: "p2"},
+			},
+			[]models.FormPage{{ID: "p1"}, {ID: "p2", ShowIf: []models.FieldCondition{answered("a")}}},
+			"cycle",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFormSchema(tt.fields, tt.pages)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("refused: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want an error mentioning %q", err, tt.err)
+			}
+		})
+	}
+}
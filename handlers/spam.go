@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+type SpamHandler struct {
+	tokens *services.SpamTokenIssuer
+}
+
+func NewSpamHandler(tokens *services.SpamTokenIssuer) *SpamHandler {
+	return &SpamHandler{tokens: tokens}
+}
+
+// IssueToken returns a submission token for a comment or form. Clients fetch it
+// when the form is shown and send it back as spam_token; when pow_difficulty is
+// above zero they must also send a pow_nonce such that sha256(token + ":" + nonce)
+// starts with that many zero bits.
+func (h *SpamHandler) IssueToken(c *gin.Context) {
+	token, err := h.tokens.Issue()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "pow_difficulty": h.tokens.Difficulty()})
+}
+
+// evaluateSpam runs the spam filter, writing the error response when the
+// submission is refused outright
+func evaluateSpam(c *gin.Context, filter *services.SpamFilter, sub services.SpamSubmission) (services.SpamVerdict, bool) {
+	verdict, err := filter.Evaluate(sub)
+	if err != nil {
+		var rejection *services.SpamRejection
+		if !errors.As(err, &rejection) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check submission"})
+			return verdict, false
+		}
+		if rejection.RetryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(rejection.RetryAfter.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": rejection.Message})
+			return verdict, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": rejection.Message})
+		return verdict, false
+	}
+	return verdict, true
+}
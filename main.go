@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/aslotsu/monkreflections-form-api/config"
 	"github.com/aslotsu/monkreflections-form-api/handlers"
@@ -10,126 +13,280 @@ import (
 	"github.com/aslotsu/monkreflections-form-api/services"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 )
 
+// maxSubmissionBodyBytes caps the size of a public form submission payload
+const maxSubmissionBodyBytes = 256 * 1024
+
+// maxUploadBodyBytes caps a public form file upload request, including multipart overhead
+const maxUploadBodyBytes = 26 * 1024 * 1024
+
+// orphanedUploadMaxAge is how long an unattached form upload is kept before cleanup
+const orphanedUploadMaxAge = 24 * time.Hour
+
+// Spam filter tuning. Comments scoring spamThreshold or more are marked as spam
+// and form submissions are refused.
+const (
+	spamThreshold      = 5.0
+	spamMinSubmitTime  = 3 * time.Second
+	spamTokenMaxAge    = 2 * time.Hour
+	spamMaxLinks       = 2
+	spamHoneypotScore  = 10.0
+	spamTooFastScore   = 5.0
+	spamBadTokenScore  = 2.0
+	spamKeywordScore   = 2.0
+	spamExtraLinkScore = 1.5
+)
+
+// commentEditWindow is how long commenters can edit or delete their own comments
+const commentEditWindow = 15 * time.Minute
+
+// emailOutboxInterval is how often queued notification emails are checked for delivery
+const emailOutboxInterval = 30 * time.Second
+
+// adminSessionTTL is how long an admin stays logged in
+const adminSessionTTL = 12 * time.Hour
+
+// Rate limit policies. Every API request counts against apiRateLimit per client
+// IP, and authenticated requests also against credentialRateLimit per API key or
+// admin user; public writes and login have tighter per-IP limits.
+var (
+	apiRateLimit = middleware.RateLimitPolicy{
+		Name: "api", Bucket: services.TokenBucket{Capacity: 300, Period: time.Minute}, Key: middleware.RateLimitByIP,
+	}
+	credentialRateLimit = middleware.RateLimitPolicy{
+		Name: "credential", Bucket: services.TokenBucket{Capacity: 300, Period: time.Minute}, Key: middleware.RateLimitByCredential,
+	}
+	loginRateLimit = middleware.RateLimitPolicy{
+		Name: "login", Bucket: services.TokenBucket{Capacity: 10, Period: time.Minute}, Key: middleware.RateLimitByIP,
+	}
+	commentRateLimit = middleware.RateLimitPolicy{
+		Name: "comments", Bucket: services.TokenBucket{Capacity: 5, Period: time.Minute}, Key: middleware.RateLimitByIP,
+	}
+	commentEditRateLimit = middleware.RateLimitPolicy{
+		Name: "comment-edits", Bucket: services.TokenBucket{Capacity: 20, Period: time.Minute}, Key: middleware.RateLimitByIP,
+	}
+	submissionRateLimit = middleware.RateLimitPolicy{
+		Name: "submissions", Bucket: services.TokenBucket{Capacity: 10, Period: time.Minute}, Key: middleware.RateLimitByIP,
+	}
+	uploadRateLimit = middleware.RateLimitPolicy{
+		Name: "uploads", Bucket: services.TokenBucket{Capacity: 20, Period: time.Minute}, Key: middleware.RateLimitByIP,
+	}
+)
+
+// rateLimitCleanupInterval is how often refilled buckets are removed from the Postgres store
+const rateLimitCleanupInterval = 10 * time.Minute
+
 func main() {
 	// Load environment variables from .env file
-	err := godotenv.Load()
+	config.LoadEnv()
+
+	// Connect to database and run migrations
+	db := config.ConnectDBFromURL(config.DatabaseURL())
+	defer db.Close()
+
+	// Initialize file storage (S3, an S3-compatible service or local disk) for
+	// blog images and form file uploads
+	storage, err := services.NewStorage()
+	if err != nil {
+		log.Printf("Warning: storage not initialized (blog image and form file uploads disabled): %v", err)
+		storage = nil
+	} else {
+		log.Printf("Storage initialized (%s)", services.StorageDriver())
+	}
+	imageSizes, err := services.ImageSizesFromEnv()
 	if err != nil {
-		log.Println("Warning: .env file not found, using environment variables")
+		log.Fatalf("Invalid image variants: %v", err)
 	}
 
-	// Get database URL from environment
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL == "" {
-		log.Fatal("DATABASE_URL environment variable not set")
+	// Initialize mailer (optional - queued form notification emails stay pending until configured)
+	mailer, err := services.NewMailer()
+	if err != nil {
+		log.Printf("Warning: mailer not initialized (form notification emails will stay queued): %v", err)
+	} else {
+		go services.NewEmailOutboxWorker(db, mailer, emailOutboxInterval).Run(context.Background())
+		log.Println("Email outbox worker started")
 	}
 
-	// Connect to database
-	db := config.ConnectDBFromURL(databaseURL)
-	defer db.Close()
+	// Rate limit buckets live in memory unless RATE_LIMIT_STORE=postgres, which
+	// shares them between replicas
+	var rateLimitStore services.RateLimitStore
+	switch os.Getenv("RATE_LIMIT_STORE") {
+	case "", "memory":
+		rateLimitStore = services.NewMemoryRateLimitStore()
+	case "postgres":
+		// Tokens signed by one replica are checked by another, so a random
+		// secret per process won't do
+		for _, name := range []string{"SPAM_TOKEN_SECRET", "COMMENT_TOKEN_SECRET"} {
+			if os.Getenv(name) == "" {
+				log.Fatalf("%s must be set when RATE_LIMIT_STORE=postgres", name)
+			}
+		}
+		pgStore := services.NewPostgresRateLimitStore(db)
+		rateLimitStore = pgStore
+		go func() {
+			ticker := time.NewTicker(rateLimitCleanupInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if _, err := pgStore.DeleteFullBuckets(context.Background()); err != nil {
+					log.Printf("Rate limit bucket cleanup failed: %v", err)
+				}
+			}
+		}()
+	default:
+		log.Fatal("RATE_LIMIT_STORE must be memory or postgres")
+	}
 
-	// Initialize S3 service (optional - for blog image uploads)
-	var s3Service *services.S3Service
-	s3Service, err = services.NewS3Service()
+	// Spam protection for public comments and form submissions
+	spamTokens, err := services.NewSpamTokenIssuer()
 	if err != nil {
-		log.Printf("Warning: S3 service not initialized (blog image uploads disabled): %v", err)
-		s3Service = nil
-	} else {
-		log.Println("S3 service initialized successfully")
+		log.Fatalf("Failed to initialize spam tokens: %v", err)
+	}
+	spamChecks := []services.SpamCheck{
+		services.HoneypotCheck{Score: spamHoneypotScore},
+		services.NewTimingCheck(spamTokens, spamMinSubmitTime, spamTokenMaxAge, spamTooFastScore, spamBadTokenScore),
+		services.NewProofOfWorkCheck(spamTokens, spamTokenMaxAge,
+			services.NewKeyedRateLimiter(rateLimitStore, "spent-spam-tokens", services.TokenBucket{Capacity: 1, Period: spamTokenMaxAge})),
+		services.NewContentHeuristicCheck(services.DefaultSpamKeywords, spamMaxLinks, spamKeywordScore, spamExtraLinkScore),
+	}
+	// Form submissions are already limited per IP by submissionRateLimit
+	commentSpamFilter := services.NewSpamFilter(spamThreshold, append(spamChecks, services.NewRateLimitCheck(
+		services.NewKeyedRateLimiter(rateLimitStore, "comment-ips", services.TokenBucket{Capacity: 5, Period: 10 * time.Minute}),
+		services.NewKeyedRateLimiter(rateLimitStore, "comment-emails", services.TokenBucket{Capacity: 10, Period: time.Hour}),
+	))...)
+	formSpamFilter := services.NewSpamFilter(spamThreshold, append(spamChecks, services.NewRateLimitCheck(
+		nil,
+		services.NewKeyedRateLimiter(rateLimitStore, "submission-emails", services.TokenBucket{Capacity: 5, Period: time.Hour}),
+	))...)
+
+	// Comment edit tokens and email verification links
+	commentSigner, err := services.NewSignerFromEnv("COMMENT_TOKEN_SECRET")
+	if err != nil {
+		log.Fatalf("Failed to initialize comment tokens: %v", err)
+	}
+	commentConfig := handlers.CommentConfig{
+		EditWindow:               commentEditWindow,
+		RequireEmailVerification: os.Getenv("COMMENT_EMAIL_VERIFICATION") == "true",
+		VerificationURL:          os.Getenv("COMMENT_VERIFY_URL"),
+	}
+	if commentConfig.RequireEmailVerification && commentConfig.VerificationURL == "" {
+		log.Fatal("COMMENT_VERIFY_URL must be set when COMMENT_EMAIL_VERIFICATION is enabled")
+	}
+
+	// Admin login sessions. Cookies are Secure unless SESSION_COOKIE_SECURE=false
+	// (plain-HTTP local development); SameSite=None is needed when the dashboard
+	// and the API are on different sites.
+	sessionConfig := handlers.SessionConfig{
+		TTL:            adminSessionTTL,
+		CookieDomain:   os.Getenv("SESSION_COOKIE_DOMAIN"),
+		CookieSecure:   os.Getenv("SESSION_COOKIE_SECURE") != "false",
+		CookieSameSite: http.SameSiteLaxMode,
+		TOTPIssuer:     "Monk Reflections",
+	}
+	switch os.Getenv("SESSION_COOKIE_SAMESITE") {
+	case "", "lax":
+	case "strict":
+		sessionConfig.CookieSameSite = http.SameSiteStrictMode
+	case "none":
+		sessionConfig.CookieSameSite = http.SameSiteNoneMode
+	default:
+		log.Fatal("SESSION_COOKIE_SAMESITE must be lax, strict or none")
 	}
 
 	// Create Gin router
 	router := gin.Default()
 
+	// Client IPs come from X-Forwarded-For only when set by a trusted proxy
+	if err := router.SetTrustedProxies(config.TrustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Configure CORS
 	router.Use(cors.New(config.GetCORSConfig()))
 
+	// Tag each request with an ID for logs and the audit log
+	router.Use(middleware.RequestID())
+
 	// Initialize handlers
-	formHandler := handlers.NewFormHandler(db)
-	blogHandler := handlers.NewBlogHandler(db, s3Service)
+	formHandler := handlers.NewFormHandler(
+		db, storage, formSpamFilter,
+		services.NewKeyedRateLimiter(rateLimitStore, "confirmation-recipients", services.TokenBucket{Capacity: 3, Period: time.Hour}),
+	)
+	blogHandler := handlers.NewBlogHandler(db, storage, imageSizes, commentConfig.RequireEmailVerification)
+	authorHandler := handlers.NewAuthorHandler(db)
+	auditHandler := handlers.NewAuditHandler(db)
 	eventHandler := handlers.NewEventHandler(db)
 	bookHandler := handlers.NewBookHandler(db)
-	commentHandler := handlers.NewCommentHandler(db)
+	commentHandler := handlers.NewCommentHandler(db, commentSpamFilter, commentSigner, commentConfig)
+	spamHandler := handlers.NewSpamHandler(spamTokens)
+	apiKeyHandler := handlers.NewAPIKeyHandler(services.NewAPIKeyStore(db))
+	authHandler := handlers.NewAuthHandler(
+		db, sessionConfig,
+		services.NewKeyedRateLimiter(rateLimitStore, "login-attempts", services.TokenBucket{Capacity: 10, Period: 15 * time.Minute}),
+	)
 	authMiddleware := middleware.NewAuthMiddleware(db)
 
+	// Remove form uploads that were never attached to a submission
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			removed, err := formHandler.CleanupOrphanedUploads(orphanedUploadMaxAge)
+			if err != nil {
+				log.Printf("Orphaned upload cleanup failed: %v", err)
+			} else if removed > 0 {
+				log.Printf("Removed %d orphaned form uploads", removed)
+			}
+		}
+	}()
+
+	// Remove presigned blog image uploads that were never completed
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			removed, err := blogHandler.CleanupExpiredImageUploads()
+			if err != nil {
+				log.Printf("Expired image upload cleanup failed: %v", err)
+			} else if removed > 0 {
+				log.Printf("Removed %d expired blog image uploads", removed)
+			}
+		}
+	}()
+
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"status":  "ok",
 			"service": "monkreflections-form-api",
 			"version": "1.0.0",
-			"s3":      s3Service != nil,
+			"storage": storage != nil,
+			"mailer":  mailer != nil,
 		})
 	})
 
-	// Register routes
-	api := router.Group("/api")
-	{
-		forms := api.Group("/forms")
-		{
-			forms.GET("", formHandler.GetAllForms)
-			forms.POST("", formHandler.CreateForm)
-			forms.GET("/:id", formHandler.GetFormByID)
-			forms.PUT("/:id", formHandler.UpdateForm)
-			forms.DELETE("/:id", formHandler.DeleteForm)
-		}
-
-		// Blog routes
-		blogs := api.Group("/blogs")
-		{
-			blogs.GET("", blogHandler.GetAllBlogs)
-			blogs.GET("/:id", blogHandler.GetBlogByID)
-
-			// Protected blog routes (require API key)
-			blogs.POST("", authMiddleware.RequireAPIKey(), blogHandler.CreateBlog)
-			blogs.PUT("/:id", authMiddleware.RequireAPIKey(), blogHandler.UpdateBlog)
-			blogs.DELETE("/:id", authMiddleware.RequireAPIKey(), blogHandler.DeleteBlog)
-			blogs.POST("/:id/upload-image", authMiddleware.RequireAPIKey(), blogHandler.UploadBlogImage)
-		}
-
-		// Event routes
-		events := api.Group("/events")
-		{
-			events.GET("", eventHandler.GetAllEvents)
-			events.GET("/:id", eventHandler.GetEventByID)
-
-			// Protected event routes (require API key)
-			events.POST("", authMiddleware.RequireAPIKey(), eventHandler.CreateEvent)
-			events.PUT("/:id", authMiddleware.RequireAPIKey(), eventHandler.UpdateEvent)
-			events.DELETE("/:id", authMiddleware.RequireAPIKey(), eventHandler.DeleteEvent)
-		}
-
-		// Book routes
-		books := api.Group("/books")
-		{
-			books.GET("", bookHandler.GetAllBooks)
-			books.GET("/:id", bookHandler.GetBookByID)
-
-			// Protected book routes (require API key)
-			books.POST("", authMiddleware.RequireAPIKey(), bookHandler.CreateBook)
-			books.PUT("/:id", authMiddleware.RequireAPIKey(), bookHandler.UpdateBook)
-			books.DELETE("/:id", authMiddleware.RequireAPIKey(), bookHandler.DeleteBook)
-		}
-
-		// Comment routes
-		comments := api.Group("/comments")
-		{
-			// Public routes - get approved comments
-			comments.GET("/blog/:blog_id", commentHandler.GetCommentsByBlogID)
-			comments.GET("/slug/:slug", commentHandler.GetCommentsByBlogSlug)
-
-			// Public route - submit a comment (creates with 'pending' status)
-			comments.POST("", commentHandler.CreateComment)
-
-			// Admin routes (require API key)
-			comments.GET("", authMiddleware.RequireAPIKey(), commentHandler.GetAllComments)
-			comments.PUT("/:id", authMiddleware.RequireAPIKey(), commentHandler.UpdateComment)
-			comments.DELETE("/:id", authMiddleware.RequireAPIKey(), commentHandler.DeleteComment)
-		}
+	// Local storage files are served by the API itself
+	var fileHandler *handlers.FileHandler
+	if localStorage, ok := storage.(*services.LocalStorage); ok {
+		fileHandler = handlers.NewFileHandler(localStorage)
 	}
 
+	registerRoutes(router, routeHandlers{
+		auth:      authMiddleware,
+		rateLimit: rateLimitStore,
+		forms:     formHandler,
+		blogs:     blogHandler,
+		authors:   authorHandler,
+		audit:     auditHandler,
+		events:    eventHandler,
+		books:     bookHandler,
+		comments:  commentHandler,
+		spam:      spamHandler,
+		apiKeys:   apiKeyHandler,
+		login:     authHandler,
+		files:     fileHandler,
+	})
+
 	// Start server (use Railway's PORT env var if available)
 	port := os.Getenv("PORT")
 	if port == "" {
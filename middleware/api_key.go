@@ -3,29 +3,80 @@ package middleware
 import (
 	"context"
 	"crypto/sha256"
-	"database/sql"
 	"encoding/hex"
+	"errors"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/aslotsu/monkreflections-form-api/config"
 	"github.com/aslotsu/monkreflections-form-api/models"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 )
 
+// Context keys set by RequireAPIKey for the authenticated key
+const (
+	ContextAPIKeyID     = "api_key_id"
+	ContextAPIKeyName   = "api_key_name"
+	ContextAPIKeyScopes = "api_key_scopes"
+)
+
+// apiKeyUsageThrottle is how often a key's last use is written while it is in steady use
+const apiKeyUsageThrottle = time.Minute
+
 type AuthMiddleware struct {
-	db *pgxpool.Pool
+	db    config.DB
+	usage chan apiKeyUsage
 }
 
-func NewAuthMiddleware(db *pgxpool.Pool) *AuthMiddleware {
-	return &AuthMiddleware{db: db}
+// apiKeyUsage is a successful authentication waiting to be recorded
+type apiKeyUsage struct {
+	id int
+	ip string
 }
 
-func (am *AuthMiddleware) RequireAPIKey() gin.HandlerFunc {
+func NewAuthMiddleware(db config.DB) *AuthMiddleware {
+	am := &AuthMiddleware{
+		db:    db,
+		usage: make(chan apiKeyUsage, 256),
+	}
+	go am.recordUsage()
+	return am
+}
+
+// recordUsage writes last_used_at and last_used_ip off the request path
+func (am *AuthMiddleware) recordUsage() {
+	for u := range am.usage {
+		_, err := am.db.Exec(
+			context.Background(),
+			`UPDATE api_keys SET last_used_at = (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'), last_used_ip = $2
+			WHERE id = $1 AND (last_used_at IS NULL OR last_used_ip IS DISTINCT FROM $2
+				OR last_used_at < (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') - make_interval(secs => $3))`,
+			u.id, u.ip, apiKeyUsageThrottle.Seconds(),
+		)
+		if err != nil {
+			log.Printf("Failed to record use of API key %d: %v", u.id, err)
+		}
+	}
+}
+
+// RequireAPIKey accepts requests carrying a valid API key that has every one of
+// the given scopes. Keys missing a scope get a 403 naming it. Without an
+// Authorization header, an admin user's session cookie is accepted instead,
+// with the scopes of the user's role.
+func (am *AuthMiddleware) RequireAPIKey(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			if token, err := c.Cookie(SessionCookieName); err == nil && token != "" {
+				am.authenticateSession(c, token, scopes...)
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header or login session required"})
 			c.Abort()
 			return
 		}
@@ -52,12 +103,15 @@ func (am *AuthMiddleware) RequireAPIKey() gin.HandlerFunc {
 		var apiKEyRecord models.ApiKey
 		err := am.db.QueryRow(
 			context.Background(),
-			"SELECT id, key_hash, name, created_at FROM api_keys WHERE key_hash = $1",
+			"SELECT id, key_hash, COALESCE(name, ''), scopes, created_at, expires_at, revoked_at FROM api_keys WHERE key_hash = $1",
 			hashString,
-		).Scan(&apiKEyRecord.ID, &apiKEyRecord.KeyHash, &apiKEyRecord.Name, &apiKEyRecord.CreatedAt)
+		).Scan(
+			&apiKEyRecord.ID, &apiKEyRecord.KeyHash, &apiKEyRecord.Name, &apiKEyRecord.Scopes,
+			&apiKEyRecord.CreatedAt, &apiKEyRecord.ExpiresAt, &apiKEyRecord.RevokedAt,
+		)
 
 		if err != nil {
-			if err == sql.ErrNoRows {
+			if errors.Is(err, pgx.ErrNoRows) {
 				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
 			} else {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error validating API key"})
@@ -66,7 +120,57 @@ func (am *AuthMiddleware) RequireAPIKey() gin.HandlerFunc {
 			return
 		}
 
+		if apiKEyRecord.RevokedAt != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "API key has been revoked"})
+			c.Abort()
+			return
+		}
+		if apiKEyRecord.ExpiresAt != nil && !time.Now().Before(*apiKEyRecord.ExpiresAt) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "API key has expired"})
+			c.Abort()
+			return
+		}
+
+		for _, scope := range scopes {
+			if !HasScope(apiKEyRecord.Scopes, scope) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":         "API key is missing the " + scope + " scope",
+					"missing_scope": scope,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		// Dropped rather than blocking the request if the recorder falls behind
+		select {
+		case am.usage <- apiKeyUsage{id: apiKEyRecord.ID, ip: c.ClientIP()}:
+		default:
+		}
+
 		// API key is valid, continue with the request
+		c.Set(ContextAPIKeyID, apiKEyRecord.ID)
+		c.Set(ContextAPIKeyName, apiKEyRecord.Name)
+		c.Set(ContextAPIKeyScopes, apiKEyRecord.Scopes)
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// HasScope reports whether a key's scopes grant scope
+func HasScope(granted []string, scope string) bool {
+	return slices.Contains(granted, scope) || slices.Contains(granted, models.ScopeAll)
+}
+
+// ActorName identifies who made an authenticated request, for moderation and audit records
+func ActorName(c *gin.Context) string {
+	if name := c.GetString(ContextUserName); name != "" {
+		return name
+	}
+	if name := c.GetString(ContextAPIKeyName); name != "" {
+		return name
+	}
+	if id := c.GetInt(ContextAPIKeyID); id != 0 {
+		return "API key #" + strconv.Itoa(id)
+	}
+	return "unknown"
+}
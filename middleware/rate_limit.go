@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitKeyFunc picks the key a request is counted under
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// RateLimitByIP counts requests per client IP, as resolved through the
+// router's trusted proxies
+func RateLimitByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitByCredential counts requests per API key or admin user. It reads the
+// identity RequireAPIKey or RequireSession accepted, so it must come after them;
+// requests they haven't authenticated are counted per client IP. Counting by an
+// unchecked Authorization header would give a client a fresh bucket for every
+// made-up key.
+func RateLimitByCredential(c *gin.Context) string {
+	if id := c.GetInt(ContextAPIKeyID); id != 0 {
+		return "key:" + strconv.Itoa(id)
+	}
+	if id := c.GetInt(ContextUserID); id != 0 {
+		return "user:" + strconv.Itoa(id)
+	}
+	return RateLimitByIP(c)
+}
+
+// RateLimitPolicy is a named token bucket applied to some routes
+type RateLimitPolicy struct {
+	Name   string // keeps the policy's buckets apart from other policies' in the store
+	Bucket services.TokenBucket
+	Key    RateLimitKeyFunc
+}
+
+// rateLimitStoreTimeout bounds a store lookup. Requests go through if the store fails.
+const rateLimitStoreTimeout = time.Second
+
+// RateLimit applies a policy, reporting the bucket in RateLimit-Limit,
+// RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers and
+// responding 429 with Retry-After once it is empty. Where several policies
+// apply to a route, the headers describe the one with the fewest requests left.
+func RateLimit(store services.RateLimitStore, policy RateLimitPolicy) gin.HandlerFunc {
+	policyHeader := strconv.Itoa(policy.Bucket.Capacity) + ";w=" + strconv.Itoa(int(policy.Bucket.Period.Seconds()))
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), rateLimitStoreTimeout)
+		defer cancel()
+
+		result, err := store.Take(ctx, policy.Name+":"+policy.Key(c), policy.Bucket)
+		if err != nil {
+			log.Printf("Rate limit store failed, allowing request: %v", err)
+			c.Next()
+			return
+		}
+
+		if remaining, err := strconv.Atoi(c.Writer.Header().Get("RateLimit-Remaining")); err != nil || result.Remaining <= remaining {
+			c.Header("RateLimit-Limit", strconv.Itoa(policy.Bucket.Capacity))
+			c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+			c.Header("RateLimit-Policy", policyHeader)
+		}
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// RequestIDHeader carries the request ID, both ways
+	RequestIDHeader = "X-Request-ID"
+
+	// ContextRequestID is the context key for the request ID
+	ContextRequestID = "request_id"
+)
+
+// validRequestID limits the IDs accepted from clients and proxies
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,100}$`)
+
+// RequestID gives every request an ID, reusing an upstream X-Request-ID when it
+// looks sane, and returns it in the response header so logs and audit entries
+// can be matched to a request
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Set(ContextRequestID, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// SessionCookieName is the HttpOnly cookie holding an admin user's session token
+	SessionCookieName = "admin_session"
+
+	// CSRFHeader must carry the session's CSRF token on requests that change
+	// anything, since browsers attach the session cookie automatically
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// Context keys set for requests authenticated with a session
+const (
+	ContextUserID    = "user_id"
+	ContextUserName  = "user_name"
+	ContextUserEmail = "user_email"
+	ContextUserRole  = "user_role"
+	ContextSessionID = "session_id"
+	ContextCSRFToken = "csrf_token"
+)
+
+// RequireSession accepts only requests from a logged-in admin user, for
+// endpoints about the user's own account
+func (am *AuthMiddleware) RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := c.Cookie(SessionCookieName)
+		if err != nil || token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+			c.Abort()
+			return
+		}
+		am.authenticateSession(c, token)
+	}
+}
+
+// OptionalSession identifies a logged-in admin user on a public endpoint without
+// requiring one. Requests with no valid session, or no valid CSRF token on a
+// write, continue anonymously.
+func (am *AuthMiddleware) OptionalSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := c.Cookie(SessionCookieName)
+		if err != nil || token == "" {
+			c.Next()
+			return
+		}
+		session, err := am.lookupSession(token)
+		if err == nil && validCSRF(c, session.csrfToken) {
+			session.set(c)
+		}
+		c.Next()
+	}
+}
+
+// adminSession is a valid session and its user
+type adminSession struct {
+	id, userID                   int
+	csrfToken, name, email, role string
+}
+
+// lookupSession finds an unexpired session of an enabled user by its token
+func (am *AuthMiddleware) lookupSession(token string) (adminSession, error) {
+	var s adminSession
+	err := am.db.QueryRow(
+		context.Background(),
+		`SELECT s.id, s.csrf_token, u.id, u.name, u.email, u.role
+		FROM admin_sessions s
+		JOIN admin_users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') AND u.disabled_at IS NULL`,
+		services.HashToken(token),
+	).Scan(&s.id, &s.csrfToken, &s.userID, &s.name, &s.email, &s.role)
+	return s, err
+}
+
+// set records the session on the request context
+func (s adminSession) set(c *gin.Context) {
+	c.Set(ContextSessionID, s.id)
+	c.Set(ContextCSRFToken, s.csrfToken)
+	c.Set(ContextUserID, s.userID)
+	c.Set(ContextUserName, s.name)
+	c.Set(ContextUserEmail, s.email)
+	c.Set(ContextUserRole, s.role)
+}
+
+// validCSRF reports whether a request may use the session: reads always can,
+// anything else must carry the session's CSRF token
+func validCSRF(c *gin.Context, csrfToken string) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(c.GetHeader(CSRFHeader)), []byte(csrfToken)) == 1
+}
+
+// authenticateSession checks a session token, and that the user's role grants
+// every one of the given scopes, then continues or aborts the request
+func (am *AuthMiddleware) authenticateSession(c *gin.Context, token string, scopes ...string) {
+	session, err := am.lookupSession(token)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired, please log in again"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error validating session"})
+		}
+		c.Abort()
+		return
+	}
+
+	if !validCSRF(c, session.csrfToken) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid " + CSRFHeader + " header"})
+		c.Abort()
+		return
+	}
+
+	for _, scope := range scopes {
+		if !HasScope(models.RoleScopes[session.role], scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":         "Your " + session.role + " role does not allow this",
+				"missing_scope": scope,
+			})
+			c.Abort()
+			return
+		}
+	}
+
+	session.set(c)
+	c.Next()
+}
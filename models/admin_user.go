@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// Admin user roles. Editors can change everything; authors can write blogs and
+// events but only edit their own.
+const (
+	RoleEditor = "editor"
+	RoleAuthor = "author"
+)
+
+// RoleScopes are the API key scopes a signed-in user has, by role
+var RoleScopes = map[string][]string{
+	RoleEditor: {ScopeAll},
+	RoleAuthor: {ScopeBlogsWrite, ScopeEventsWrite},
+}
+
+// AdminUser is a person who signs in to the admin dashboard. Password and
+// TOTP secrets are never serialized.
+type AdminUser struct {
+	ID          int        `json:"id"`
+	Email       string     `json:"email"`
+	Name        string     `json:"name"`
+	Role        string     `json:"role"`
+	Slug        string     `json:"slug"` // public author profile handle
+	Bio         string     `json:"bio,omitempty"`
+	TOTPEnabled bool       `json:"totp_enabled"`
+	DisabledAt  *time.Time `json:"disabled_at,omitempty"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	TOTPCode string `json:"totp_code,omitempty"` // required once two-factor is enabled
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=12,max=256"`
+}
+
+type UpdateProfileRequest struct {
+	Name *string `json:"name,omitempty" binding:"omitempty,min=1,max=255"`
+	Bio  *string `json:"bio,omitempty" binding:"omitempty,max=5000"`
+}
+
+// Author is the public profile of an admin user who has published posts
+type Author struct {
+	Slug      string `json:"slug"`
+	Name      string `json:"name"`
+	Bio       string `json:"bio,omitempty"`
+	PostCount int    `json:"post_count"`
+}
+
+// AuthorProfile is an author with their published posts, newest first
+type AuthorProfile struct {
+	Author
+	Posts []Blog `json:"posts"`
+}
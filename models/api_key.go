@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// API key scopes. Each protected route requires one of them.
+const (
+	ScopeBlogsWrite       = "blogs:write"
+	ScopeEventsWrite      = "events:write" // also covers the admin event views with organizer contact details, limited to their own events for authors
+	ScopeCommentsModerate = "comments:moderate"
+	ScopeBooksWrite       = "books:write"
+	ScopeFormsAdmin       = "forms:admin"
+	ScopeKeysAdmin        = "keys:admin" // create, revoke and rotate API keys
+	ScopeAuditRead        = "audit:read"
+
+	// ScopeAll grants every scope. Keys created before scopes existed have it.
+	ScopeAll = "*"
+)
+
+// APIKeyScopes lists every scope a key can be given
+var APIKeyScopes = []string{
+	ScopeBlogsWrite,
+	ScopeEventsWrite,
+	ScopeCommentsModerate,
+	ScopeBooksWrite,
+	ScopeFormsAdmin,
+	ScopeKeysAdmin,
+	ScopeAuditRead,
+	ScopeAll,
+}
+
+type ApiKey struct {
+	ID         int        `json:"id"`
+	KeyHash    string     `json:"-"`
+	KeyPrefix  string     `json:"key_prefix,omitempty"` // first characters of the key, to tell keys apart
+	Name       string     `json:"name,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	ReplacedBy *int       `json:"replaced_by,omitempty"` // set once the key has been rotated
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type RotateAPIKeyRequest struct {
+	GracePeriodHours *int       `json:"grace_period_hours,omitempty" binding:"omitempty,min=0,max=720"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"` // expiry of the new key
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit log actions
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// Kinds of actor recorded in the audit log
+const (
+	ActorTypeUser   = "user"
+	ActorTypeAPIKey = "api_key"
+	ActorTypeCLI    = "cli"
+)
+
+// Audited resource types
+const (
+	AuditResourceBlog           = "blog"
+	AuditResourceBlogImage      = "blog_image"
+	AuditResourceEvent          = "event"
+	AuditResourceBook           = "book"
+	AuditResourceForm           = "form"
+	AuditResourceFormSubmission = "form_submission"
+	AuditResourceComment        = "comment"
+)
+
+// AuditActor is who made a change and the request it came from
+type AuditActor struct {
+	Name      string
+	Type      string
+	ID        *int // admin user or API key ID
+	IPAddress string
+	RequestID string
+}
+
+// AuditEntry records one change to one resource. For updates, Before and After
+// hold only the fields that changed; creates have only After and deletes only Before.
+type AuditEntry struct {
+	ID           int64           `json:"id"`
+	Actor        string          `json:"actor"`
+	ActorType    string          `json:"actor_type"`
+	ActorID      *int            `json:"actor_id,omitempty"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   int             `json:"resource_id"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	IPAddress    string          `json:"ip_address,omitempty"`
+	RequestID    string          `json:"request_id,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
@@ -10,34 +10,76 @@ type Blog struct {
 	Slug      string    `json:"slug,omitempty"`
 	Content   string    `json:"content"` // JSONB content as string
 	Author    string    `json:"author,omitempty"`
+	AuthorID  *int      `json:"author_id,omitempty"`
+	AuthorSlug string   `json:"author_slug,omitempty"` // links to /api/authors/:slug
+	CommentCount int    `json:"comment_count"` // approved comments
+	CommentSettings BlogCommentSettings `json:"comment_settings"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// BlogCommentSettings controls who may comment on a blog and how
+type BlogCommentSettings struct {
+	Enabled        bool       `json:"enabled"`
+	CloseAfterDays *int       `json:"close_after_days"` // days after publishing; nil never closes
+	AutoApprove    bool       `json:"auto_approve"`     // approve commenters with an earlier approved comment
+	MaxDepth       *int       `json:"max_depth"`        // levels of nesting, 1 = no replies; nil is unlimited
+	Open           bool       `json:"open"`             // enabled and not yet closed
+	ClosesAt       *time.Time `json:"closes_at,omitempty"`
+}
+
+// BlogCommentSettingsRequest sets comment settings; omitted fields are left unchanged.
+// A close_after_days or max_depth of 0 removes the limit.
+type BlogCommentSettingsRequest struct {
+	Enabled        *bool `json:"enabled,omitempty"`
+	CloseAfterDays *int  `json:"close_after_days,omitempty" binding:"omitempty,min=0,max=36500"`
+	AutoApprove    *bool `json:"auto_approve,omitempty"`
+	MaxDepth       *int  `json:"max_depth,omitempty" binding:"omitempty,min=0,max=10"`
+}
+
 type BlogImage struct {
 	ID       int       `json:"id"`
 	BlogID   int       `json:"blog_id"`
-	ImageKey string    `json:"image_key"` // S3 object key
+	ImageKey string    `json:"image_key"` // storage object key
 	ImageURL string    `json:"image_url"` // Public URL
+	Width    int       `json:"width,omitempty"`  // intrinsic size in pixels; 0 for images uploaded before it was recorded
+	Height   int       `json:"height,omitempty"`
+	WebPKey  string    `json:"webp_key,omitempty"` // WebP copy of the original, except for GIFs
+	WebPURL  string    `json:"webp_url,omitempty"`
+	Variants []ImageVariant `json:"variants"` // resized copies, narrowest first, for srcset
 	AltText  string    `json:"alt_text,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
-type ApiKey struct {
-	ID      int       `json:"id"`
-	KeyHash string    `json:"key_hash"`
-	Name    string    `json:"name,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
+// ImageVariant is a blog image scaled down to one of the configured widths
+type ImageVariant struct {
+	Name    string `json:"name"` // e.g. thumbnail, medium, large
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Key     string `json:"key"`
+	URL     string `json:"url"`
+	WebPKey string `json:"webp_key"`
+	WebPURL string `json:"webp_url"`
+}
+
+// CreateBlogImageUploadRequest asks for a URL to upload a blog image straight to storage
+type CreateBlogImageUploadRequest struct {
+	Filename    string `json:"filename" binding:"required,max=255"`
+	ContentType string `json:"content_type" binding:"required"` // image/jpeg, image/png or image/gif
+	Size        int64  `json:"size" binding:"required,min=1"`    // exact size in bytes
+	AltText     string `json:"alt_text,omitempty" binding:"max=500"`
 }
 
 type CreateBlogRequest struct {
 	Title   string                 `json:"title" binding:"required"`
 	Content map[string]any         `json:"content" binding:"required"`
-	Author  string                 `json:"author,omitempty"`
+	AuthorID *int                  `json:"author_id,omitempty"` // editors and API keys only; defaults to the signed-in user
+	CommentSettings *BlogCommentSettingsRequest `json:"comment_settings,omitempty"`
 }
 
 type UpdateBlogRequest struct {
 	Title   string                 `json:"title,omitempty"`
 	Content map[string]any         `json:"content,omitempty"`
-	Author  string                 `json:"author,omitempty"`
+	AuthorID *int                  `json:"author_id,omitempty"` // editors and API keys only
+	CommentSettings *BlogCommentSettingsRequest `json:"comment_settings,omitempty"`
 }
\ No newline at end of file
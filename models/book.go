@@ -29,6 +29,7 @@ type Book struct {
 	AverageRating   float64   `json:"average_rating"`
 	ReviewCount     int       `json:"review_count"`
 	CreatedBy       string    `json:"created_by,omitempty"`
+	CreatedByID     *int      `json:"created_by_id,omitempty"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 }
@@ -55,7 +56,7 @@ type CreateBookRequest struct {
 	Tags            any       `json:"tags,omitempty"`
 	IsFeatured      bool      `json:"is_featured"`
 	IsPublished     bool      `json:"is_published"`
-	CreatedBy       string    `json:"created_by,omitempty"`
+	CreatedByID     *int      `json:"created_by_id,omitempty"` // editors and API keys only; defaults to the signed-in user
 }
 
 type UpdateBookRequest struct {
@@ -2,29 +2,125 @@ package models
 
 import "time"
 
+// Comment statuses
+const (
+	CommentStatusPending  = "pending"
+	CommentStatusApproved = "approved"
+	CommentStatusRejected = "rejected"
+	CommentStatusSpam     = "spam"
+)
+
+// Bulk moderation actions
+const (
+	ModerationActionApprove = "approve"
+	ModerationActionReject  = "reject"
+	ModerationActionSpam    = "spam"
+	ModerationActionDelete  = "delete"
+)
+
 type Comment struct {
-	ID          int       `json:"id"`
-	BlogID      int       `json:"blog_id"`
-	BlogSlug    string    `json:"blog_slug,omitempty"`
-	AuthorName  string    `json:"author_name"`
-	AuthorEmail string    `json:"author_email"`
-	Content     string    `json:"content"`
-	Status      string    `json:"status"` // pending, approved, rejected, spam
-	ParentID    *int      `json:"parent_id,omitempty"` // for nested replies
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID             int        `json:"id"`
+	BlogID         int        `json:"blog_id"`
+	BlogSlug       string     `json:"blog_slug,omitempty"`
+	AuthorName     string     `json:"author_name"`
+	AuthorEmail    string     `json:"author_email"`
+	Content        string     `json:"content"`
+	Status         string     `json:"status"`              // pending, approved, rejected, spam
+	ParentID       *int       `json:"parent_id,omitempty"` // for nested replies
+	SpamScore      float64    `json:"spam_score,omitempty"`
+	SpamReasons    []string   `json:"spam_reasons,omitempty"`
+	ModeratedBy    string     `json:"moderated_by,omitempty"`
+	ModeratedAt    *time.Time `json:"moderated_at,omitempty"`
+	ModerationNote string     `json:"moderation_note,omitempty"`
+	EmailVerified  bool       `json:"email_verified"`
+	EditedAt       *time.Time `json:"edited_at,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"` // emptied by its commenter, kept for its replies
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// PublicComment is the view of an approved comment served to readers. It never
+// includes the commenter's email address.
+type PublicComment struct {
+	ID         int        `json:"id"`
+	BlogID     int        `json:"blog_id"`
+	BlogSlug   string     `json:"blog_slug,omitempty"`
+	AuthorName string     `json:"author_name"`
+	AvatarHash string     `json:"avatar_hash"` // SHA-256 of the trimmed, lowercased email, as used by Gravatar
+	IsAuthor   bool       `json:"is_author"`   // posted by the blog's author while logged in
+	Content    string     `json:"content"`
+	ParentID   *int       `json:"parent_id,omitempty"`
+	Edited     bool       `json:"edited"`
+	EditedAt   *time.Time `json:"edited_at,omitempty"`
+	Deleted    bool       `json:"deleted,omitempty"` // removed by its commenter; kept, empty, because it has replies
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// CommentThread is a comment with its replies nested beneath it
+type CommentThread struct {
+	PublicComment
+	Replies []*CommentThread `json:"replies"`
 }
 
 type CreateCommentRequest struct {
 	BlogID      int    `json:"blog_id" binding:"required"`
-	BlogSlug    string `json:"blog_slug,omitempty"`
 	AuthorName  string `json:"author_name" binding:"required"`
 	AuthorEmail string `json:"author_email" binding:"required,email"`
 	Content     string `json:"content" binding:"required"`
 	ParentID    *int   `json:"parent_id,omitempty"`
+	Website     string `json:"website,omitempty"` // honeypot, left empty by real visitors
+	SpamToken   string `json:"spam_token,omitempty"`
+	PowNonce    string `json:"pow_nonce,omitempty"`
 }
 
 type UpdateCommentRequest struct {
-	Status  string `json:"status,omitempty"`
+	Status  string `json:"status,omitempty" binding:"omitempty,oneof=pending approved rejected spam"`
 	Content string `json:"content,omitempty"`
+	Note    string `json:"note,omitempty"` // moderation note, recorded with a status change
+}
+
+// UpdateOwnCommentRequest is sent by a commenter editing their own comment with its edit token
+type UpdateOwnCommentRequest struct {
+	Content   string `json:"content" binding:"required"`
+	Website   string `json:"website,omitempty"` // honeypot, as for new comments
+	SpamToken string `json:"spam_token,omitempty"`
+	PowNonce  string `json:"pow_nonce,omitempty"`
+}
+
+type VerifyCommenterRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// CommentEdit keeps a comment's content from before an edit by its author
+type CommentEdit struct {
+	ID              int       `json:"id"`
+	CommentID       int       `json:"comment_id"`
+	PreviousContent string    `json:"previous_content"`
+	EditedAt        time.Time `json:"edited_at"`
+}
+
+// CommentModeration records one moderation decision
+type CommentModeration struct {
+	ID        int       `json:"id"`
+	CommentID int       `json:"comment_id"`
+	Action    string    `json:"action"`
+	Note      string    `json:"note,omitempty"`
+	Moderator string    `json:"moderator"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BulkModerationRequest struct {
+	IDs    []int  `json:"ids" binding:"required,min=1,max=500"`
+	Action string `json:"action" binding:"required,oneof=approve reject spam delete"`
+	Note   string `json:"note,omitempty"`
+}
+
+// ModerationQueueBlog groups a blog's pending comments, oldest first
+type ModerationQueueBlog struct {
+	BlogID       int       `json:"blog_id"`
+	BlogTitle    string    `json:"blog_title"`
+	BlogSlug     string    `json:"blog_slug,omitempty"`
+	PendingCount int       `json:"pending_count"`
+	Comments     []Comment `json:"comments"`
 }
@@ -35,14 +35,15 @@ type Event struct {
 	VideoURL              string    `json:"video_url,omitempty"`
 	LivestreamURL         string    `json:"livestream_url,omitempty"`
 	OrganizerName         string    `json:"organizer_name"`
-	OrganizerEmail        string    `json:"organizer_email"`
-	OrganizerPhone        string    `json:"organizer_phone"`
+	OrganizerEmail        string    `json:"organizer_email,omitempty"` // admin responses only
+	OrganizerPhone        string    `json:"organizer_phone,omitempty"` // admin responses only
 	Speakers              string    `json:"speakers,omitempty"` // JSONB stored as string
 	Sponsors              string    `json:"sponsors,omitempty"` // JSONB stored as string
 	Tags                  string    `json:"tags,omitempty"`     // JSONB stored as string
 	IsFeatured            bool      `json:"is_featured"`
 	IsPublic              bool      `json:"is_public"`
 	CreatedBy             string    `json:"created_by,omitempty"`
+	CreatedByID           *int      `json:"created_by_id,omitempty"`
 	CreatedAt             time.Time `json:"created_at"`
 	UpdatedAt             time.Time `json:"updated_at"`
 }
@@ -86,7 +87,7 @@ type CreateEventRequest struct {
 	Tags                  any       `json:"tags,omitempty"`     // Can be array or JSON
 	IsFeatured            bool      `json:"is_featured"`
 	IsPublic              bool      `json:"is_public"`
-	CreatedBy             string    `json:"created_by,omitempty"`
+	CreatedByID           *int      `json:"created_by_id,omitempty"` // editors and API keys only; defaults to the signed-in user
 }
 
 type UpdateEventRequest struct {
@@ -128,4 +129,5 @@ type UpdateEventRequest struct {
 	Tags                  any       `json:"tags,omitempty"`
 	IsFeatured            *bool     `json:"is_featured,omitempty"`
 	IsPublic              *bool     `json:"is_public,omitempty"`
+	CreatedByID           *int      `json:"created_by_id,omitempty"` // editors and API keys only
 }
@@ -4,20 +4,173 @@ import (
 	"time"
 )
 
+// Supported form field types
+const (
+	FieldTypeText     = "text"
+	FieldTypeEmail    = "email"
+	FieldTypeNumber   = "number"
+	FieldTypeSelect   = "select"
+	FieldTypeCheckbox = "checkbox"
+	FieldTypeDate     = "date"
+	FieldTypeFile     = "file"
+)
+
+// Supported show-if condition operators
+const (
+	ConditionEquals      = "equals"
+	ConditionNotEquals   = "not_equals"
+	ConditionContains    = "contains"
+	ConditionGreaterThan = "greater_than"
+	ConditionLessThan    = "less_than"
+)
+
 type Form struct {
-	ID        int       `json:"id"`
-	Title     string    `json:"title"`
-	Data      string    `json:"data"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID             int               `json:"id"`
+	Title          string            `json:"title"`
+	Data           string            `json:"data"`
+	Fields         []FormField       `json:"fields"`
+	Pages          []FormPage        `json:"pages"`
+	IsPublished    bool              `json:"is_published"`
+	CurrentVersion int               `json:"current_version"`
+	OpensAt        *time.Time        `json:"opens_at,omitempty"`
+	ClosesAt       *time.Time        `json:"closes_at,omitempty"`
+	MaxResponses   *int              `json:"max_responses,omitempty"`
+	ClosedMessage  string            `json:"closed_message,omitempty"`
+	Notifications  FormNotifications `json:"notifications"`
+	ResponseCount  int               `json:"response_count"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// PublicForm is the read-only view of a published form served to respondents
+type PublicForm struct {
+	ID            int         `json:"id"`
+	Title         string      `json:"title"`
+	Fields        []FormField `json:"fields"`
+	Pages         []FormPage  `json:"pages"`
+	Version       int         `json:"version"`
+	OpensAt       *time.Time  `json:"opens_at,omitempty"`
+	ClosesAt      *time.Time  `json:"closes_at,omitempty"`
+	IsOpen        bool        `json:"is_open"`
+	ClosedMessage string      `json:"closed_message,omitempty"`
+}
+
+// FormNotifications configures the emails sent when a form is submitted. The
+// confirmation subject and body are text/template templates executed with the
+// submitter's answers, e.g. "Thanks {{.first_name}}".
+type FormNotifications struct {
+	AdminRecipients     []string `json:"admin_recipients,omitempty"`
+	SendConfirmation    bool     `json:"send_confirmation"`
+	ConfirmationField   string   `json:"confirmation_field,omitempty"` // email field holding the submitter's address
+	ConfirmationSubject string   `json:"confirmation_subject,omitempty"`
+	ConfirmationBody    string   `json:"confirmation_body,omitempty"`
+}
+
+// FormVersion is an immutable snapshot of a form's schema. A new version is
+// recorded whenever the fields or pages change, and every submission points
+// at the version it was validated against.
+type FormVersion struct {
+	ID        int         `json:"id"`
+	FormID    int         `json:"form_id"`
+	Version   int         `json:"version"`
+	Title     string      `json:"title"`
+	Fields    []FormField `json:"fields"`
+	Pages     []FormPage  `json:"pages"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// FormPage is a step of a multi-step form. Fields are assigned to a page by ID.
+type FormPage struct {
+	ID          string           `json:"id" binding:"required"`
+	Title       string           `json:"title"`
+	Description string           `json:"description,omitempty"`
+	ShowIf      []FieldCondition `json:"show_if,omitempty"` // all must match for the page to apply
+}
+
+// FieldCondition compares another field's answer to a value
+type FieldCondition struct {
+	Field    string `json:"field" binding:"required"`
+	Operator string `json:"operator" binding:"required"`
+	Value    any    `json:"value"`
+}
+
+// FormField describes a single input in a form's schema
+type FormField struct {
+	Name         string           `json:"name" binding:"required"`
+	Label        string           `json:"label"`
+	Type         string           `json:"type" binding:"required"`
+	Required     bool             `json:"required"`
+	Placeholder  string           `json:"placeholder,omitempty"`
+	HelpText     string           `json:"help_text,omitempty"`
+	Options      []string         `json:"options,omitempty"`       // select and checkbox groups
+	Multiple     bool             `json:"multiple,omitempty"`      // select and file: allow several values
+	MinLength    *int             `json:"min_length,omitempty"`    // text
+	MaxLength    *int             `json:"max_length,omitempty"`    // text
+	Min          *float64         `json:"min,omitempty"`           // number
+	Max          *float64         `json:"max,omitempty"`           // number
+	AllowedTypes []string         `json:"allowed_types,omitempty"` // file: extensions such as ".pdf"
+	MaxFileSize  int64            `json:"max_file_size,omitempty"` // file: bytes
+	Page         string           `json:"page,omitempty"`          // FormPage ID for multi-step forms
+	ShowIf       []FieldCondition `json:"show_if,omitempty"`       // all must match for the field to apply
+}
+
+type FormSubmission struct {
+	ID          int       `json:"id"`
+	FormID      int       `json:"form_id"`
+	FormVersion int       `json:"form_version"`
+	Data        string    `json:"data"` // JSONB validated answers
+	IPAddress   string    `json:"ip_address,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// FormUpload is a file uploaded for a form's file field. It stays unattached
+// until a submission references it, and is cleaned up if that never happens.
+type FormUpload struct {
+	ID           string    `json:"id"`
+	FormID       int       `json:"form_id"`
+	SubmissionID *int      `json:"submission_id,omitempty"`
+	FieldName    string    `json:"field_name"`
+	ObjectKey    string    `json:"-"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type"`
+	SizeBytes    int64     `json:"size_bytes"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 type CreateFormRequest struct {
-	Title string         `json:"title" binding:"required"`
-	Data  map[string]any `json:"data" binding:"required"`
+	Title         string             `json:"title" binding:"required"`
+	Data          map[string]any     `json:"data"`
+	Fields        []FormField        `json:"fields" binding:"required,dive"`
+	Pages         []FormPage         `json:"pages" binding:"omitempty,dive"`
+	IsPublished   bool               `json:"is_published"`
+	OpensAt       *time.Time         `json:"opens_at,omitempty"`
+	ClosesAt      *time.Time         `json:"closes_at,omitempty"`
+	MaxResponses  *int               `json:"max_responses,omitempty" binding:"omitempty,min=1"`
+	ClosedMessage string             `json:"closed_message,omitempty"`
+	Notifications *FormNotifications `json:"notifications,omitempty"`
 }
 
 type UpdateFormRequest struct {
-	Title string         `json:"title"`
-	Data  map[string]any `json:"data"`
+	Title         string             `json:"title"`
+	Data          map[string]any     `json:"data"`
+	Fields        []FormField        `json:"fields" binding:"omitempty,dive"`
+	Pages         []FormPage         `json:"pages" binding:"omitempty,dive"`
+	IsPublished   *bool              `json:"is_published,omitempty"`
+	OpensAt       *time.Time         `json:"opens_at,omitempty"`
+	ClosesAt      *time.Time         `json:"closes_at,omitempty"`
+	MaxResponses  *int               `json:"max_responses,omitempty" binding:"omitempty,min=0"` // 0 removes the cap
+	ClosedMessage string             `json:"closed_message,omitempty"`
+	Notifications *FormNotifications `json:"notifications,omitempty"`
+	// Absent or empty values above leave a setting unchanged; these remove one
+	ClearOpensAt       bool `json:"clear_opens_at,omitempty"`
+	ClearClosesAt      bool `json:"clear_closes_at,omitempty"`
+	ClearClosedMessage bool `json:"clear_closed_message,omitempty"`
+}
+
+type CreateFormSubmissionRequest struct {
+	Data      map[string]any `json:"data" binding:"required"`
+	Website   string         `json:"website,omitempty"` // honeypot, left empty by real visitors
+	SpamToken string         `json:"spam_token,omitempty"`
+	PowNonce  string         `json:"pow_nonce,omitempty"`
 }
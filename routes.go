@@ -0,0 +1,195 @@
+package main
+
+import (
+	"github.com/aslotsu/monkreflections-form-api/handlers"
+	"github.com/aslotsu/monkreflections-form-api/middleware"
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+// routeHandlers is everything registerRoutes wires up
+type routeHandlers struct {
+	auth      *middleware.AuthMiddleware
+	rateLimit services.RateLimitStore
+	forms     *handlers.FormHandler
+	blogs     *handlers.BlogHandler
+	authors   *handlers.AuthorHandler
+	audit     *handlers.AuditHandler
+	events    *handlers.EventHandler
+	books     *handlers.BookHandler
+	comments  *handlers.CommentHandler
+	spam      *handlers.SpamHandler
+	apiKeys   *handlers.APIKeyHandler
+	login     *handlers.AuthHandler
+	files     *handlers.FileHandler // nil unless local storage is in use
+}
+
+// registerRoutes adds the API's routes, and local storage's file routes, to router
+func registerRoutes(router *gin.Engine, h routeHandlers) {
+	rateLimit := func(policy middleware.RateLimitPolicy) gin.HandlerFunc {
+		return middleware.RateLimit(h.rateLimit, policy)
+	}
+	// authenticated routes count against the accepted key's or user's own
+	// bucket, once auth has checked the credential
+	authenticated := func(group *gin.RouterGroup, auth gin.HandlerFunc) *gin.RouterGroup {
+		return group.Group("", auth, rateLimit(credentialRateLimit))
+	}
+
+	if h.files != nil {
+		router.GET(services.LocalStoragePath+"/*key", h.files.ServeFile)
+		router.PUT(services.LocalStoragePath+"/*key", h.files.UploadFile)
+	}
+
+	api := router.Group("/api", rateLimit(apiRateLimit))
+	{
+		// Form management routes (require an API key with forms:admin)
+		forms := authenticated(api.Group("/forms"), h.auth.RequireAPIKey(models.ScopeFormsAdmin))
+		{
+			forms.GET("", h.forms.GetAllForms)
+			forms.POST("", h.forms.CreateForm)
+			forms.GET("/:id", h.forms.GetFormByID)
+			forms.PUT("/:id", h.forms.UpdateForm)
+			forms.DELETE("/:id", h.forms.DeleteForm)
+			forms.GET("/:id/versions", h.forms.GetFormVersions)
+			forms.GET("/:id/versions/:version", h.forms.GetFormVersion)
+
+			forms.GET("/:id/submissions", h.forms.GetFormSubmissions)
+			forms.GET("/:id/export", h.forms.ExportFormSubmissions)
+			forms.GET("/:id/submissions/:submission_id", h.forms.GetFormSubmissionByID)
+			forms.DELETE("/:id/submissions/:submission_id", h.forms.DeleteFormSubmission)
+			forms.GET("/:id/submissions/:submission_id/files/:upload_id", h.forms.GetSubmissionFileURL)
+		}
+
+		// Admin login. The other auth routes act on the logged-in user's own account.
+		api.POST("/auth/login", rateLimit(loginRateLimit), h.login.Login)
+		auth := authenticated(api.Group("/auth"), h.auth.RequireSession())
+		{
+			auth.POST("/logout", h.login.Logout)
+			auth.GET("/me", h.login.GetCurrentUser)
+			auth.PUT("/me", h.login.UpdateProfile)
+			auth.POST("/password", h.login.ChangePassword)
+			auth.POST("/totp/setup", h.login.SetupTOTP)
+			auth.POST("/totp/enable", h.login.EnableTOTP)
+			auth.POST("/totp/disable", h.login.DisableTOTP)
+		}
+
+		// API key management routes (require an API key with keys:admin)
+		keys := authenticated(api.Group("/keys"), h.auth.RequireAPIKey(models.ScopeKeysAdmin))
+		{
+			keys.GET("", h.apiKeys.GetAllAPIKeys)
+			keys.POST("", h.apiKeys.CreateAPIKey)
+			keys.POST("/:id/revoke", h.apiKeys.RevokeAPIKey)
+			keys.POST("/:id/rotate", h.apiKeys.RotateAPIKey)
+		}
+
+		// Audit log of admin changes (requires an API key with audit:read)
+		authenticated(api, h.auth.RequireAPIKey(models.ScopeAuditRead)).GET("/audit", h.audit.GetAuditLog)
+
+		// Public form routes - read-only view of published forms and submission
+		publicForms := api.Group("/public/forms")
+		{
+			publicForms.GET("", h.forms.GetPublishedForms)
+			publicForms.GET("/:id", h.forms.GetPublishedFormByID)
+			publicForms.POST(
+				"/:id/uploads",
+				middleware.LimitRequestBody(maxUploadBodyBytes),
+				rateLimit(uploadRateLimit),
+				h.forms.UploadFormFile,
+			)
+			publicForms.POST(
+				"/:id/submissions",
+				middleware.LimitRequestBody(maxSubmissionBodyBytes),
+				rateLimit(submissionRateLimit),
+				h.forms.CreateFormSubmission,
+			)
+		}
+
+		// Public route - token for the spam checks on comments and form submissions
+		api.GET("/public/spam-token", h.spam.IssueToken)
+
+		// Blog routes
+		blogs := api.Group("/blogs")
+		{
+			blogs.GET("", h.blogs.GetAllBlogs)
+			blogs.GET("/:id", h.blogs.GetBlogByID)
+			blogs.GET("/:id/images", h.blogs.GetBlogImages)
+
+			// Protected blog routes (require an API key with blogs:write)
+			blogsAdmin := authenticated(blogs, h.auth.RequireAPIKey(models.ScopeBlogsWrite))
+			{
+				blogsAdmin.POST("", h.blogs.CreateBlog)
+				blogsAdmin.PUT("/:id", h.blogs.UpdateBlog)
+				blogsAdmin.DELETE("/:id", h.blogs.DeleteBlog)
+				blogsAdmin.POST("/:id/upload-image", h.blogs.UploadBlogImage)
+				blogsAdmin.POST("/:id/image-uploads", h.blogs.CreateBlogImageUpload)
+				blogsAdmin.POST("/:id/image-uploads/:upload_id/complete", h.blogs.CompleteBlogImageUpload)
+			}
+		}
+
+		// Public author profiles
+		api.GET("/authors", h.authors.GetAuthors)
+		api.GET("/authors/:slug", h.authors.GetAuthor)
+
+		// Event routes
+		events := api.Group("/events")
+		{
+			events.GET("", h.events.GetAllEvents)
+			events.GET("/:id", h.events.GetEventByID)
+
+			// Protected event routes (require an API key with events:write)
+			eventsAdmin := authenticated(events, h.auth.RequireAPIKey(models.ScopeEventsWrite))
+			{
+				eventsAdmin.GET("/admin", h.events.GetAllEventsAdmin)
+				eventsAdmin.GET("/admin/:id", h.events.GetEventByIDAdmin)
+				eventsAdmin.POST("", h.events.CreateEvent)
+				eventsAdmin.PUT("/:id", h.events.UpdateEvent)
+				eventsAdmin.DELETE("/:id", h.events.DeleteEvent)
+			}
+		}
+
+		// Book routes
+		books := api.Group("/books")
+		{
+			books.GET("", h.books.GetAllBooks)
+			books.GET("/:id", h.books.GetBookByID)
+
+			// Protected book routes (require an API key with books:write)
+			booksAdmin := authenticated(books, h.auth.RequireAPIKey(models.ScopeBooksWrite))
+			{
+				booksAdmin.POST("", h.books.CreateBook)
+				booksAdmin.PUT("/:id", h.books.UpdateBook)
+				booksAdmin.DELETE("/:id", h.books.DeleteBook)
+			}
+		}
+
+		// Comment routes
+		comments := api.Group("/comments")
+		{
+			// Public routes - get approved comments
+			comments.GET("/blog/:blog_id", h.comments.GetCommentsByBlogID)
+			comments.GET("/slug/:slug", h.comments.GetCommentsByBlogSlug)
+
+			// Public route - submit a comment (creates with 'pending' status)
+			comments.POST("", rateLimit(commentRateLimit), h.auth.OptionalSession(), h.comments.CreateComment)
+
+			// Public routes - commenters confirm their email, and edit or delete
+			// their own comments with the edit token (X-Edit-Token header)
+			comments.POST("/verify", rateLimit(commentEditRateLimit), h.comments.VerifyCommenter)
+			comments.PUT("/:id/own", rateLimit(commentEditRateLimit), h.comments.UpdateOwnComment)
+			comments.DELETE("/:id/own", rateLimit(commentEditRateLimit), h.comments.DeleteOwnComment)
+
+			// Admin routes (require an API key with comments:moderate)
+			moderation := authenticated(comments, h.auth.RequireAPIKey(models.ScopeCommentsModerate))
+			{
+				moderation.GET("", h.comments.GetAllComments)
+				moderation.GET("/queue", h.comments.GetModerationQueue)
+				moderation.POST("/moderate", h.comments.BulkModerateComments)
+				moderation.GET("/:id/moderations", h.comments.GetCommentModerations)
+				moderation.GET("/:id/edits", h.comments.GetCommentEdits)
+				moderation.PUT("/:id", h.comments.UpdateComment)
+				moderation.DELETE("/:id", h.comments.DeleteComment)
+			}
+		}
+	}
+}
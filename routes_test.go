@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aslotsu/monkreflections-form-api/handlers"
+	"github.com/aslotsu/monkreflections-form-api/middleware"
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/aslotsu/monkreflections-form-api/services"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Keys known to fakeDB, by the scopes they were given
+const (
+	formsAdminKey = "forms-admin-key"
+	allScopesKey  = "all-scopes-key"
+	blogsOnlyKey  = "blogs-only-key"
+)
+
+// fakeDB stands in for Postgres. It knows the test API keys, has no other
+// rows, and refuses transactions.
+type fakeDB struct {
+	keys map[string]models.ApiKey // by hash
+}
+
+func newFakeDB() *fakeDB {
+	db := &fakeDB{keys: make(map[string]models.ApiKey)}
+	for id, key := range []struct {
+		secret string
+		scopes []string
+	}{
+		{formsAdminKey, []string{models.ScopeFormsAdmin}},
+		{allScopesKey, []string{models.ScopeAll}},
+		{blogsOnlyKey, []string{models.ScopeBlogsWrite}},
+	} {
+		hash := services.HashAPIKey(key.secret)
+		db.keys[hash] = models.ApiKey{ID: id + 1, KeyHash: hash, Name: key.secret, Scopes: key.scopes, CreatedAt: time.Now()}
+	}
+	return db
+}
+
+func (db *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return nil, errors.New("fake database has no transactions")
+}
+
+func (db *fakeDB) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+func (db *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+func (db *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if strings.Contains(sql, "FROM api_keys WHERE key_hash = $1") {
+		if key, ok := db.keys[args[0].(string)]; ok {
+			return fakeRow{values: []any{key.ID, key.KeyHash, key.Name, key.Scopes, key.CreatedAt, key.ExpiresAt, key.RevokedAt}}
+		}
+	}
+	return fakeRow{err: pgx.ErrNoRows}
+}
+
+type fakeRow struct {
+	values []any
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(dest) != len(r.values) {
+		return errors.New("fake row scanned into the wrong number of columns")
+	}
+	for i, value := range r.values {
+		target := reflect.ValueOf(dest[i]).Elem()
+		if value == nil || reflect.ValueOf(value).Kind() == reflect.Pointer && reflect.ValueOf(value).IsNil() {
+			target.SetZero()
+			continue
+		}
+		target.Set(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+// fakeRows is an empty result set
+type fakeRows struct{}
+
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeRows) Next() bool                                   { return false }
+func (r *fakeRows) Scan(dest ...any) error                       { return errors.New("no rows") }
+func (r *fakeRows) Values() ([]any, error)                       { return nil, errors.New("no rows") }
+func (r *fakeRows) RawValues() [][]byte                          { return nil }
+func (r *fakeRows) Conn() *pgx.Conn                              { return nil }
+
+// newTestRouter registers the API's routes against fakeDB, without storage or a mailer
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db := newFakeDB()
+	signer, err := services.NewSignerFromEnv("COMMENT_TOKEN_SECRET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spamTokens, err := services.NewSpamTokenIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := services.NewMemoryRateLimitStore()
+	loginLimiter := services.NewKeyedRateLimiter(store, "login-attempts", services.TokenBucket{Capacity: 10, Period: 15 * time.Minute})
+
+	router := gin.New()
+	registerRoutes(router, routeHandlers{
+		auth:      middleware.NewAuthMiddleware(db),
+		rateLimit: store,
+		forms:     handlers.NewFormHandler(db, nil, services.NewSpamFilter(spamThreshold), nil),
+		blogs:     handlers.NewBlogHandler(db, nil, services.DefaultImageSizes, false),
+		authors:   handlers.NewAuthorHandler(db),
+		audit:     handlers.NewAuditHandler(db),
+		events:    handlers.NewEventHandler(db),
+		books:     handlers.NewBookHandler(db),
+		comments:  handlers.NewCommentHandler(db, services.NewSpamFilter(spamThreshold), signer, handlers.CommentConfig{EditWindow: commentEditWindow}),
+		spam:      handlers.NewSpamHandler(spamTokens),
+		apiKeys:   handlers.NewAPIKeyHandler(services.NewAPIKeyStore(nil)),
+		login:     handlers.NewAuthHandler(db, handlers.SessionConfig{TTL: adminSessionTTL}, loginLimiter),
+	})
+	return router
+}
+
+// testPath fills in a route's parameters
+func testPath(route string) string {
+	var parts []string
+	for _, part := range strings.Split(route, "/") {
+		switch {
+		case part == ":upload_id":
+			part = "3f1c2a9e-6b7d-4c1e-9a51-2d0f8e7b6c45"
+		case strings.HasPrefix(part, ":"):
+			part = "1"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func serve(router *gin.Engine, method, path, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// routesUnder lists the registered routes whose paths start with prefix
+func routesUnder(t *testing.T, router *gin.Engine, prefix string) gin.RoutesInfo {
+	t.Helper()
+	var routes gin.RoutesInfo
+	for _, route := range router.Routes() {
+		if route.Path == prefix || strings.HasPrefix(route.Path, prefix+"/") {
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) == 0 {
+		t.Fatalf("no routes registered under %s", prefix)
+	}
+	return routes
+}
+
+func TestFormManagementRoutesRequireFormsAdmin(t *testing.T) {
+	router := newTestRouter(t)
+
+	for _, route := range routesUnder(t, router, "/api/forms") {
+		path := testPath(route.Path)
+		t.Run(route.Method+" "+route.Path, func(t *testing.T) {
+			if w := serve(router, route.Method, path, ""); w.Code != http.StatusUnauthorized {
+				t.Errorf("without credentials: got %d, want 401", w.Code)
+			}
+			if w := serve(router, route.Method, path, "not-a-key"); w.Code != http.StatusUnauthorized {
+				t.Errorf("with an unknown key: got %d, want 401", w.Code)
+			}
+			if w := serve(router, route.Method, path, blogsOnlyKey); w.Code != http.StatusForbidden {
+				t.Errorf("without forms:admin: got %d, want 403", w.Code)
+			}
+			for _, key := range []string{formsAdminKey, allScopesKey} {
+				if w := serve(router, route.Method, path, key); w.Code == http.StatusUnauthorized || w.Code == http.StatusForbidden {
+					t.Errorf("with %s: got %d, want the request to pass authentication", key, w.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestFormManagementRoutesCoverSensitiveData(t *testing.T) {
+	router := newTestRouter(t)
+	registered := make(map[string]bool)
+	for _, route := range routesUnder(t, router, "/api/forms") {
+		registered[route.Method+" "+route.Path] = true
+	}
+
+	for _, route := range []string{
+		"GET /api/forms",
+		"GET /api/forms/:id",
+		"PUT /api/forms/:id",
+		"DELETE /api/forms/:id",
+		"GET /api/forms/:id/submissions",
+		"GET /api/forms/:id/export",
+		"GET /api/forms/:id/submissions/:submission_id",
+		"GET /api/forms/:id/submissions/:submission_id/files/:upload_id",
+	} {
+		if !registered[route] {
+			t.Errorf("%s is not registered behind forms:admin", route)
+		}
+	}
+}
+
+func TestFormsAdminKeyListsForms(t *testing.T) {
+	router := newTestRouter(t)
+
+	w := serve(router, http.MethodGet, "/api/forms", formsAdminKey)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200: %s", w.Code, w.Body)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != "[]" {
+		t.Errorf("got body %s, want []", body)
+	}
+}
+
+func TestPublicFormRoutesAllowAnonymousAccess(t *testing.T) {
+	router := newTestRouter(t)
+
+	public := make(map[string]bool)
+	for _, route := range routesUnder(t, router, "/api/public/forms") {
+		public[route.Method+" "+route.Path] = true
+		if w := serve(router, route.Method, testPath(route.Path), ""); w.Code == http.StatusUnauthorized || w.Code == http.StatusForbidden {
+			t.Errorf("%s %s: got %d without credentials, want it public", route.Method, route.Path, w.Code)
+		}
+	}
+
+	// Only reading published forms, uploading files and submitting are public
+	want := map[string]bool{
+		"GET /api/public/forms":                  true,
+		"GET /api/public/forms/:id":              true,
+		"POST /api/public/forms/:id/uploads":     true,
+		"POST /api/public/forms/:id/submissions": true,
+	}
+	if !reflect.DeepEqual(public, want) {
+		t.Errorf("public form routes are %v, want %v", public, want)
+	}
+
+	if w := serve(router, http.MethodGet, "/api/public/forms", ""); w.Code != http.StatusOK {
+		t.Errorf("GET /api/public/forms: got %d, want 200", w.Code)
+	}
+}
+
+func TestAPIRateLimitIgnoresUncheckedCredentials(t *testing.T) {
+	router := newTestRouter(t)
+
+	// A made-up key on each request must not get a fresh bucket
+	var last *httptest.ResponseRecorder
+	for i := 0; i <= apiRateLimit.Bucket.Capacity; i++ {
+		last = serve(router, http.MethodGet, "/api/public/forms", fmt.Sprintf("made-up-key-%d", i))
+	}
+	if last.Code != http.StatusTooManyRequests {
+		t.Errorf("request %d from one IP: got %d, want 429", apiRateLimit.Bucket.Capacity+1, last.Code)
+	}
+}
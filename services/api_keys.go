@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// apiKeyPrefixLength is how many leading characters of a key are stored in the
+// clear so admins can tell keys apart
+const apiKeyPrefixLength = 8
+
+// ErrAPIKeyNotFound is returned for keys that don't exist or can no longer be changed
+var ErrAPIKeyNotFound = errors.New("API key not found or no longer active")
+
+// apiKeyColumns lists the api_keys columns in the order scanAPIKey reads them
+const apiKeyColumns = `id, COALESCE(name, ''), COALESCE(key_prefix, ''), scopes, created_at,
+	expires_at, revoked_at, last_used_at, COALESCE(last_used_ip, ''), replaced_by`
+
+func scanAPIKey(row pgx.Row) (models.ApiKey, error) {
+	var key models.ApiKey
+	err := row.Scan(
+		&key.ID, &key.Name, &key.KeyPrefix, &key.Scopes, &key.CreatedAt,
+		&key.ExpiresAt, &key.RevokedAt, &key.LastUsedAt, &key.LastUsedIP, &key.ReplacedBy,
+	)
+	return key, err
+}
+
+// HashAPIKey returns the SHA-256 hash stored in place of a key
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func generateAPIKey() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %v", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// ValidateScopes checks every scope is one a key can be given
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(models.APIKeyScopes, scope) {
+			return fmt.Errorf("unknown scope %q, must be one of: %s", scope, strings.Join(models.APIKeyScopes, ", "))
+		}
+	}
+	return nil
+}
+
+// APIKeyStore creates, lists, revokes and rotates API keys. Only hashes are
+// stored, so a key's secret is returned once, when it is created.
+type APIKeyStore struct {
+	db *pgxpool.Pool
+}
+
+func NewAPIKeyStore(db *pgxpool.Pool) *APIKeyStore {
+	return &APIKeyStore{db: db}
+}
+
+// Create stores a new key and returns its secret. expiresAt may be nil for a key that never expires.
+func (s *APIKeyStore) Create(ctx context.Context, name string, scopes []string, expiresAt *time.Time) (string, models.ApiKey, error) {
+	if err := ValidateScopes(scopes); err != nil {
+		return "", models.ApiKey{}, err
+	}
+	return insertAPIKey(ctx, s.db, name, scopes, expiresAt)
+}
+
+// rowQuerier is satisfied by *pgxpool.Pool and pgx.Tx
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func insertAPIKey(ctx context.Context, db rowQuerier, name string, scopes []string, expiresAt *time.Time) (string, models.ApiKey, error) {
+	secret, err := generateAPIKey()
+	if err != nil {
+		return "", models.ApiKey{}, err
+	}
+	if expiresAt != nil {
+		utc := expiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	key, err := scanAPIKey(db.QueryRow(
+		ctx,
+		`INSERT INTO api_keys (key_hash, key_prefix, name, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+apiKeyColumns,
+		HashAPIKey(secret), secret[:apiKeyPrefixLength], name, scopes, expiresAt,
+	))
+	if err != nil {
+		return "", models.ApiKey{}, fmt.Errorf("failed to store API key: %v", err)
+	}
+	return secret, key, nil
+}
+
+// List returns every key, newest first, without their hashes
+func (s *APIKeyStore) List(ctx context.Context) ([]models.ApiKey, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+	defer rows.Close()
+
+	keys := []models.ApiKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke stops a key working immediately
+func (s *APIKeyStore) Revoke(ctx context.Context, id int) error {
+	result, err := s.db.Exec(
+		ctx,
+		"UPDATE api_keys SET revoked_at = (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') WHERE id = $1 AND revoked_at IS NULL",
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Rotate issues a replacement with the same name and scopes. The old key keeps
+// working for the grace period so clients can switch over, then expires; the
+// time it expires is returned with the new key.
+func (s *APIKeyStore) Rotate(ctx context.Context, id int, grace time.Duration, expiresAt *time.Time) (string, models.ApiKey, time.Time, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return "", models.ApiKey{}, time.Time{}, fmt.Errorf("failed to rotate API key: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	old, err := scanAPIKey(tx.QueryRow(
+		ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE id = $1 AND revoked_at IS NULL AND replaced_by IS NULL
+			AND (expires_at IS NULL OR expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'))
+		FOR UPDATE`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", models.ApiKey{}, time.Time{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return "", models.ApiKey{}, time.Time{}, fmt.Errorf("failed to rotate API key: %v", err)
+	}
+
+	secret, key, err := insertAPIKey(ctx, tx, old.Name, old.Scopes, expiresAt)
+	if err != nil {
+		return "", models.ApiKey{}, time.Time{}, err
+	}
+
+	// The grace period never extends a key's existing expiry
+	graceEnds := time.Now().UTC().Add(grace)
+	if old.ExpiresAt != nil && old.ExpiresAt.Before(graceEnds) {
+		graceEnds = *old.ExpiresAt
+	}
+	_, err = tx.Exec(ctx, "UPDATE api_keys SET expires_at = $2, replaced_by = $3 WHERE id = $1", id, graceEnds, key.ID)
+	if err != nil {
+		return "", models.ApiKey{}, time.Time{}, fmt.Errorf("failed to rotate API key: %v", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", models.ApiKey{}, time.Time{}, fmt.Errorf("failed to rotate API key: %v", err)
+	}
+	return secret, key, graceEnds, nil
+}
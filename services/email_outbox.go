@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	outboxBatchSize   = 20
+	outboxMaxAttempts = 8
+
+	// How long a claimed message is hidden from other workers while it is sent
+	outboxLeaseDuration = 5 * time.Minute
+)
+
+// Executor is satisfied by *pgxpool.Pool and pgx.Tx, so emails can be queued in
+// the same transaction as the change that triggered them
+type Executor interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// EnqueueEmail adds a message to the durable outbox
+func EnqueueEmail(ctx context.Context, db Executor, to, subject, body string) error {
+	_, err := db.Exec(
+		ctx,
+		"INSERT INTO email_outbox (to_address, subject, body) VALUES ($1, $2, $3)",
+		to, subject, body,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to queue email: %v", err)
+	}
+	return nil
+}
+
+// EmailOutboxWorker delivers queued emails, retrying failures with exponential backoff
+type EmailOutboxWorker struct {
+	db       *pgxpool.Pool
+	mailer   *Mailer
+	interval time.Duration
+}
+
+func NewEmailOutboxWorker(db *pgxpool.Pool, mailer *Mailer, interval time.Duration) *EmailOutboxWorker {
+	return &EmailOutboxWorker{
+		db:       db,
+		mailer:   mailer,
+		interval: interval,
+	}
+}
+
+// Run processes the outbox until the context is cancelled
+func (w *EmailOutboxWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			sent, err := w.ProcessBatch(ctx)
+			if err != nil {
+				log.Printf("Email outbox: %v", err)
+				break
+			}
+			if sent < outboxBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessBatch claims and sends up to one batch of due emails. It returns the
+// number of messages claimed.
+func (w *EmailOutboxWorker) ProcessBatch(ctx context.Context) (int, error) {
+	// Claiming pushes next_attempt_at out so a crashed worker's messages are retried later
+	rows, err := w.db.Query(
+		ctx,
+		`UPDATE email_outbox SET attempts = attempts + 1, next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $1)
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, to_address, subject, body, attempts`,
+		outboxLeaseDuration.Seconds(), outboxBatchSize,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim emails: %v", err)
+	}
+
+	type claimedEmail struct {
+		id       int
+		to       string
+		subject  string
+		body     string
+		attempts int
+	}
+	var batch []claimedEmail
+	for rows.Next() {
+		var e claimedEmail
+		if err := rows.Scan(&e.id, &e.to, &e.subject, &e.body, &e.attempts); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan email: %v", err)
+		}
+		batch = append(batch, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to claim emails: %v", err)
+	}
+
+	for _, e := range batch {
+		sendErr := w.mailer.Send(e.to, e.subject, e.body)
+		if sendErr == nil {
+			_, err = w.db.Exec(
+				ctx,
+				"UPDATE email_outbox SET status = 'sent', sent_at = CURRENT_TIMESTAMP, last_error = NULL WHERE id = $1",
+				e.id,
+			)
+		} else if e.attempts >= outboxMaxAttempts {
+			log.Printf("Email outbox: giving up on email %d after %d attempts: %v", e.id, e.attempts, sendErr)
+			_, err = w.db.Exec(
+				ctx,
+				"UPDATE email_outbox SET status = 'failed', last_error = $2 WHERE id = $1",
+				e.id, sendErr.Error(),
+			)
+		} else {
+			_, err = w.db.Exec(
+				ctx,
+				"UPDATE email_outbox SET last_error = $2, next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3) WHERE id = $1",
+				e.id, sendErr.Error(), outboxBackoff(e.attempts).Seconds(),
+			)
+		}
+		if err != nil {
+			log.Printf("Email outbox: failed to record result for email %d: %v", e.id, err)
+		}
+	}
+
+	return len(batch), nil
+}
+
+// outboxBackoff doubles the retry delay after each attempt, starting at one minute
+func outboxBackoff(attempts int) time.Duration {
+	delay := time.Minute << (attempts - 1)
+	if delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+	return delay
+}
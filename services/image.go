@@ -0,0 +1,324 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/aslotsu/monkreflections-form-api/models"
+	"github.com/google/uuid"
+	"golang.org/x/image/draw"
+)
+
+// ImageSize is a named variant width. Images are scaled down to fit it,
+// keeping their aspect ratio, and never scaled up.
+type ImageSize struct {
+	Name     string
+	MaxWidth int
+}
+
+// DefaultImageSizes are the variants made when IMAGE_VARIANTS isn't set
+var DefaultImageSizes = []ImageSize{
+	{Name: "thumbnail", MaxWidth: 320},
+	{Name: "medium", MaxWidth: 800},
+	{Name: "large", MaxWidth: 1600},
+}
+
+// ImageSizesFromEnv reads variant sizes from IMAGE_VARIANTS, a comma-separated
+// list of name=width pairs such as "thumbnail=320,medium=800,large=1600"
+func ImageSizesFromEnv() ([]ImageSize, error) {
+	value := os.Getenv("IMAGE_VARIANTS")
+	if value == "" {
+		return DefaultImageSizes, nil
+	}
+
+	var sizes []ImageSize
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		name, width, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		maxWidth, err := strconv.Atoi(width)
+		if !ok || name == "" || err != nil || maxWidth < 1 {
+			return nil, fmt.Errorf("invalid IMAGE_VARIANTS entry %q, expected name=width", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate IMAGE_VARIANTS name %q", name)
+		}
+		seen[name] = true
+		sizes = append(sizes, ImageSize{Name: name, MaxWidth: maxWidth})
+	}
+	slices.SortFunc(sizes, func(a, b ImageSize) int { return a.MaxWidth - b.MaxWidth })
+	return sizes, nil
+}
+
+// ImageProcessor stores uploaded blog images along with resized variants and
+// WebP copies
+type ImageProcessor struct {
+	storage Storage
+	sizes   []ImageSize
+}
+
+func NewImageProcessor(storage Storage, sizes []ImageSize) *ImageProcessor {
+	return &ImageProcessor{storage: storage, sizes: sizes}
+}
+
+// Upload stores a blog image publicly. The file's type is sniffed from its
+// content and it is fully decoded and re-encoded, which drops EXIF and other
+// metadata; JPEGs are turned upright first. JPEG and PNG images get a WebP copy
+// and a variant for each size narrower than the image; GIFs keep their frames
+// and get neither. The returned image has everything but its ID, blog and alt
+// text filled in. Unacceptable files return an *ImageRejection.
+func (p *ImageProcessor) Upload(ctx context.Context, file io.Reader, fileSize int64, originalFilename string) (models.BlogImage, error) {
+	return p.upload(ctx, file, fileSize, originalFilename, maxImageFileSize)
+}
+
+// UploadStored processes an image a client uploaded straight to storage under
+// key, as Upload does, but allowing up to MaxDirectImageSize. The uploaded
+// object is left in place.
+func (p *ImageProcessor) UploadStored(ctx context.Context, key string, fileSize int64, originalFilename string) (models.BlogImage, error) {
+	body, err := p.storage.Get(ctx, key)
+	if err != nil {
+		return models.BlogImage{}, err
+	}
+	defer body.Close()
+	return p.upload(ctx, body, fileSize, originalFilename, MaxDirectImageSize)
+}
+
+func (p *ImageProcessor) upload(ctx context.Context, file io.Reader, fileSize int64, originalFilename string, maxSize int64) (models.BlogImage, error) {
+	if fileSize > maxSize {
+		return models.BlogImage{}, rejectImage("file too large: maximum %dMB allowed", maxSize>>20)
+	}
+
+	// Read the file content, in case the declared size was wrong
+	fileBytes, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return models.BlogImage{}, fmt.Errorf("failed to read file: %v", err)
+	}
+	if int64(len(fileBytes)) > maxSize {
+		return models.BlogImage{}, rejectImage("file too large: maximum %dMB allowed", maxSize>>20)
+	}
+
+	contentType, ext, err := sniffImageType(fileBytes)
+	if err != nil {
+		return models.BlogImage{}, err
+	}
+
+	// Generate a unique filename
+	fileID := uuid.New().String()
+	fileName := fmt.Sprintf("blogs/%s_%s%s", fileID, SanitizeFilename(originalFilename), ext)
+	stem := strings.TrimSuffix(fileName, ext)
+
+	result := models.BlogImage{ImageKey: fileName, Variants: []models.ImageVariant{}}
+
+	if ext == ".gif" {
+		g, err := decodeGIF(fileBytes)
+		if err != nil {
+			return models.BlogImage{}, err
+		}
+		result.Width, result.Height = g.Config.Width, g.Config.Height
+
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, g); err != nil {
+			return models.BlogImage{}, fmt.Errorf("failed to encode image: %v", err)
+		}
+		if err := p.put(ctx, fileName, buf.Bytes(), contentType); err != nil {
+			return models.BlogImage{}, err
+		}
+		result.ImageURL = p.storage.PublicURL(fileName)
+		return result, nil
+	}
+
+	img, err := decodeImage(fileBytes, ext)
+	if err != nil {
+		return models.BlogImage{}, err
+	}
+	bounds := img.Bounds()
+	result.Width, result.Height = bounds.Dx(), bounds.Dy()
+
+	optimizedBytes, err := encodeImage(img, ext)
+	if err != nil {
+		return models.BlogImage{}, err
+	}
+
+	// Remove whatever was stored if a later step fails
+	var stored []string
+	fail := func(err error) (models.BlogImage, error) {
+		p.deleteKeys(ctx, stored)
+		return models.BlogImage{}, err
+	}
+
+	if err := p.put(ctx, fileName, optimizedBytes, contentType); err != nil {
+		return fail(err)
+	}
+	stored = append(stored, fileName)
+	result.ImageURL = p.storage.PublicURL(fileName)
+
+	result.WebPKey = stem + ".webp"
+	if err := p.putWebP(ctx, result.WebPKey, img); err != nil {
+		return fail(err)
+	}
+	stored = append(stored, result.WebPKey)
+	result.WebPURL = p.storage.PublicURL(result.WebPKey)
+
+	for _, size := range p.sizes {
+		if size.MaxWidth >= result.Width {
+			continue
+		}
+		resized := resizeImage(img, size.MaxWidth)
+		variant := models.ImageVariant{
+			Name:    size.Name,
+			Width:   resized.Bounds().Dx(),
+			Height:  resized.Bounds().Dy(),
+			Key:     stem + "_" + size.Name + ext,
+			WebPKey: stem + "_" + size.Name + ".webp",
+		}
+
+		variantBytes, err := encodeImage(resized, ext)
+		if err != nil {
+			return fail(err)
+		}
+		if err := p.put(ctx, variant.Key, variantBytes, contentType); err != nil {
+			return fail(err)
+		}
+		stored = append(stored, variant.Key)
+		if err := p.putWebP(ctx, variant.WebPKey, resized); err != nil {
+			return fail(err)
+		}
+		stored = append(stored, variant.WebPKey)
+
+		variant.URL = p.storage.PublicURL(variant.Key)
+		variant.WebPURL = p.storage.PublicURL(variant.WebPKey)
+		result.Variants = append(result.Variants, variant)
+	}
+
+	return result, nil
+}
+
+// Delete removes all of an image's stored files
+func (p *ImageProcessor) Delete(ctx context.Context, img models.BlogImage) error {
+	keys := []string{img.ImageKey}
+	if img.WebPKey != "" {
+		keys = append(keys, img.WebPKey)
+	}
+	for _, variant := range img.Variants {
+		keys = append(keys, variant.Key)
+		if variant.WebPKey != "" {
+			keys = append(keys, variant.WebPKey)
+		}
+	}
+	for _, key := range keys {
+		if err := p.storage.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *ImageProcessor) deleteKeys(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := p.storage.Delete(ctx, key); err != nil {
+			log.Printf("Failed to clean up image %s: %v", key, err)
+		}
+	}
+}
+
+func (p *ImageProcessor) put(ctx context.Context, key string, data []byte, contentType string) error {
+	return p.storage.PutPublic(ctx, key, bytes.NewReader(data), int64(len(data)), contentType)
+}
+
+// putWebP stores a lossless WebP copy of img
+func (p *ImageProcessor) putWebP(ctx context.Context, key string, img image.Image) error {
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, img, nil); err != nil {
+		return fmt.Errorf("failed to encode WebP image: %v", err)
+	}
+	return p.put(ctx, key, buf.Bytes(), "image/webp")
+}
+
+// resizeImage scales img down to width, keeping its aspect ratio
+func resizeImage(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	height := max(1, int(math.Round(float64(bounds.Dy())*float64(width)/float64(bounds.Dx()))))
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// decodeImage decodes a JPEG or PNG within the size limits, turning JPEGs upright
+func decodeImage(data []byte, ext string) (image.Image, error) {
+	decodeConfig, decode := png.DecodeConfig, png.Decode
+	if ext == ".jpg" {
+		decodeConfig, decode = jpeg.DecodeConfig, jpeg.Decode
+	}
+
+	cfg, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, rejectImage("failed to decode image: %v", err)
+	}
+	if err := checkImageDimensions(cfg, 1); err != nil {
+		return nil, err
+	}
+
+	img, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, rejectImage("failed to decode image: %v", err)
+	}
+	if ext == ".jpg" {
+		img = applyOrientation(img, exifOrientation(data))
+	}
+	return img, nil
+}
+
+// decodeGIF decodes every frame of a GIF within the size limits
+func decodeGIF(data []byte) (*gif.GIF, error) {
+	cfg, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, rejectImage("failed to decode image: %v", err)
+	}
+	frames, err := gifFrameCount(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkImageDimensions(cfg, max(frames, 1)); err != nil {
+		return nil, err
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, rejectImage("failed to decode image: %v", err)
+	}
+	return g, nil
+}
+
+func encodeImage(img image.Image, ext string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	// Encode with quality settings
+	switch ext {
+	case ".jpg":
+		options := &jpeg.Options{Quality: 80} // 80% quality
+		err = jpeg.Encode(&buf, img, options)
+	case ".png":
+		err = png.Encode(&buf, img) // PNG is lossless but we can optimize it differently if needed
+	default:
+		err = fmt.Errorf("unsupported image format: %s", ext)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode optimized image: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	maxImageFileSize = 5 * 1024 * 1024
+
+	// MaxDirectImageSize is the limit for images uploaded straight to storage,
+	// which don't pass through the API on the way in
+	MaxDirectImageSize = 20 * 1024 * 1024
+
+	// Decompression bomb limits, checked from the image header before decoding.
+	// A GIF's limit covers all of its frames.
+	maxImageDimension = 12000
+	maxImagePixels    = 40_000_000
+
+	maxFilenameLength = 64
+)
+
+// imageFormats maps the content types accepted for blog images to the
+// extension their keys are given
+var imageFormats = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// ImageRejection is returned when an upload isn't an acceptable image, as
+// opposed to failing to store it
+type ImageRejection struct {
+	Message string
+}
+
+func (e *ImageRejection) Error() string {
+	return e.Message
+}
+
+func rejectImage(format string, args ...any) *ImageRejection {
+	return &ImageRejection{Message: fmt.Sprintf(format, args...)}
+}
+
+// IsImageContentType reports whether contentType is accepted for blog images
+func IsImageContentType(contentType string) bool {
+	_, ok := imageFormats[contentType]
+	return ok
+}
+
+// sniffImageType identifies an image from its leading bytes, ignoring the
+// name and content type the client gave it
+func sniffImageType(data []byte) (contentType, ext string, err error) {
+	contentType = http.DetectContentType(data)
+	ext, ok := imageFormats[contentType]
+	if !ok {
+		return "", "", rejectImage("file is not a JPEG, PNG or GIF image")
+	}
+	return contentType, ext, nil
+}
+
+// checkImageDimensions refuses images too large to decode safely. frames is 1
+// except for animated GIFs.
+func checkImageDimensions(cfg image.Config, frames int) error {
+	if cfg.Width < 1 || cfg.Height < 1 {
+		return rejectImage("image has no pixels")
+	}
+	if cfg.Width > maxImageDimension || cfg.Height > maxImageDimension {
+		return rejectImage("image too large: maximum %d pixels wide or high", maxImageDimension)
+	}
+	if cfg.Width*cfg.Height*frames > maxImagePixels {
+		return rejectImage("image too large: maximum %d pixels in total", maxImagePixels)
+	}
+	return nil
+}
+
+// gifFrameCount counts a GIF's frames by walking its blocks, without
+// decompressing any of them
+func gifFrameCount(data []byte) (int, error) {
+	invalid := rejectImage("invalid GIF image")
+	if len(data) < 13 {
+		return 0, invalid
+	}
+	i := 13
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1) // global color table
+	}
+
+	// skipSubBlocks moves past a chain of data sub-blocks
+	skipSubBlocks := func() bool {
+		for i < len(data) {
+			size := int(data[i])
+			i += size + 1
+			if size == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	frames := 0
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension
+			i += 2
+			if !skipSubBlocks() {
+				return 0, invalid
+			}
+		case 0x2C: // image descriptor
+			if i+10 > len(data) {
+				return 0, invalid
+			}
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1) // local color table
+			}
+			i++ // LZW minimum code size
+			if !skipSubBlocks() {
+				return 0, invalid
+			}
+			frames++
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, invalid
+		}
+	}
+	return 0, invalid
+}
+
+// exifOrientation reads the orientation tag (1 to 8) from a JPEG's EXIF data,
+// returning 1, the upright default, when there is none
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xFF {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break // image data starts, no more metadata
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		segment := data[i+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i = end
+	}
+	return 1
+}
+
+// tiffOrientation finds the orientation tag in the first IFD of EXIF's TIFF
+// structure
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < entries; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		// Orientation is tag 0x0112, a SHORT
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation turns img upright according to an EXIF orientation, since
+// re-encoding drops the tag that told viewers to do so
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w // rotated a quarter turn
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				sx, sy = x, h-1-y
+			case 5: // mirrored, quarter turn anticlockwise
+				sx, sy = y, x
+			case 6: // quarter turn clockwise
+				sx, sy = y, h-1-x
+			case 7: // mirrored, quarter turn clockwise
+				sx, sy = w-1-y, h-1-x
+			case 8: // quarter turn anticlockwise
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// SanitizeFilename reduces an uploaded file's name, without its extension, to
+// lowercase ASCII letters and digits separated by single hyphens, so it is
+// safe to put in object keys and URLs
+func SanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.TrimSuffix(name, path.Ext(name))
+
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			hyphen = false
+		} else if !hyphen && b.Len() > 0 {
+			b.WriteByte('-')
+			hyphen = true
+		}
+	}
+
+	sanitized := b.String()
+	if len(sanitized) > maxFilenameLength {
+		sanitized = sanitized[:maxFilenameLength]
+	}
+	sanitized = strings.TrimSuffix(sanitized, "-")
+	if sanitized == "" {
+		return "image"
+	}
+	return sanitized
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// gifHeader is a GIF89a header and logical screen descriptor with the given flags
+func gifHeader(flags byte) []byte {
+	return []byte{'G', 'I', 'F', '8', '9', 'a', 1, 0, 1, 0, flags, 0, 0}
+}
+
+// gifFrame is an image descriptor without a local color table, followed by
+// one data sub-block
+func gifFrame() []byte {
+	return []byte{0x2C, 0, 0, 0, 0, 1, 0, 1, 0, 0, 0x02, 0x02, 0x44, 0x01, 0x00}
+}
+
+// gifGraphicControl is a graphic control extension
+func gifGraphicControl() []byte {
+	return []byte{0x21, 0xF9, 0x04, 0, 10, 0, 0, 0x00}
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestGIFFrameCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		frames int
+		valid  bool
+	}{
+		{"one frame", concat(gifHeader(0), gifFrame(), []byte{0x3B}), 1, true},
+		{"global color table", concat(gifHeader(0x81), make([]byte, 12), gifFrame(), []byte{0x3B}), 1, true},
+		{"animated", concat(gifHeader(0), gifGraphicControl(), gifFrame(), gifGraphicControl(), gifFrame(), gifGraphicControl(), gifFrame(), []byte{0x3B}), 3, true},
+		{"local color table", concat(gifHeader(0), []byte{0x2C, 0, 0, 0, 0, 1, 0, 1, 0, 0x80}, make([]byte, 6), []byte{0x02, 0x01, 0x00, 0x00, 0x3B}), 1, true},
+		{"no frames", concat(gifHeader(0), []byte{0x3B}), 0, true},
+		{"empty", nil, 0, false},
+		{"truncated header", gifHeader(0)[:12], 0, false},
+		{"global color table past the end", concat(gifHeader(0x87), []byte{0x3B}), 0, false},
+		{"no trailer", concat(gifHeader(0), gifFrame()), 0, false},
+		{"sub-block past the end", concat(gifHeader(0), []byte{0x2C, 0, 0, 0, 0, 1, 0, 1, 0, 0, 0x02, 0xFF, 0x44}), 0, false},
+		{"sub-blocks without terminator", concat(gifHeader(0), []byte{0x2C, 0, 0, 0, 0, 1, 0, 1, 0, 0, 0x02, 0x01, 0x44}), 0, false},
+		{"truncated image descriptor", concat(gifHeader(0), []byte{0x2C, 0, 0, 0, 0}), 0, false},
+		{"local color table past the end", concat(gifHeader(0), []byte{0x2C, 0, 0, 0, 0, 1, 0, 1, 0, 0x87, 0x02}), 0, false},
+		{"extension without terminator", concat(gifHeader(0), []byte{0x21, 0xF9, 0x04, 0, 10, 0, 0}), 0, false},
+		{"extension label at the end", concat(gifHeader(0), []byte{0x21}), 0, false},
+		{"unknown block", concat(gifHeader(0), []byte{0x00, 0x3B}), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, err := gifFrameCount(tt.data)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("got error %v, want %d frames", err, tt.frames)
+				}
+				if frames != tt.frames {
+					t.Errorf("got %d frames, want %d", frames, tt.frames)
+				}
+				return
+			}
+			if _, ok := err.(*ImageRejection); !ok {
+				t.Errorf("got %d frames and error %v, want an ImageRejection", frames, err)
+			}
+		})
+	}
+}
+
+// tiffEntry is an IFD entry holding a single SHORT or LONG value
+type tiffEntry struct {
+	tag, typ uint16
+	value    uint16
+}
+
+// byteOrder is binary.LittleEndian or binary.BigEndian
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// tiffIFD builds EXIF's TIFF structure with one IFD at offset 8
+func tiffIFD(order byteOrder, entries ...tiffEntry) []byte {
+	var b []byte
+	if order == binary.LittleEndian {
+		b = []byte("II")
+	} else {
+		b = []byte("MM")
+	}
+	b = order.AppendUint16(b, 42)
+	b = order.AppendUint32(b, 8)
+	b = order.AppendUint16(b, uint16(len(entries)))
+	for _, e := range entries {
+		b = order.AppendUint16(b, e.tag)
+		b = order.AppendUint16(b, e.typ)
+		b = order.AppendUint32(b, 1)
+		b = order.AppendUint16(b, e.value)
+		b = append(b, 0, 0)
+	}
+	return order.AppendUint32(b, 0)
+}
+
+// jpegSegment is a marker segment with its length
+func jpegSegment(marker byte, payload []byte) []byte {
+	return concat([]byte{0xFF, marker}, binary.BigEndian.AppendUint16(nil, uint16(len(payload)+2)), payload)
+}
+
+func exifSegment(tiff []byte) []byte {
+	return jpegSegment(0xE1, concat([]byte("Exif\x00\x00"), tiff))
+}
+
+func jpegWith(segments ...[]byte) []byte {
+	return concat([]byte{0xFF, 0xD8}, concat(segments...), []byte{0xFF, 0xD9})
+}
+
+func orientationEntry(value uint16) tiffEntry {
+	return tiffEntry{tag: 0x0112, typ: 3, value: value}
+}
+
+func TestEXIFOrientation(t *testing.T) {
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		for orientation := 1; orientation <= 8; orientation++ {
+			data := jpegWith(jpegSegment(0xE0, []byte("JFIF\x00")), exifSegment(tiffIFD(order, orientationEntry(uint16(orientation)))))
+			if got := exifOrientation(data); got != orientation {
+				t.Errorf("%s orientation %d: got %d", order, orientation, got)
+			}
+		}
+	}
+
+	valid := tiffIFD(binary.BigEndian, orientationEntry(6))
+	pastEnd := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint32(pastEnd[4:], 0xFFFFFFF0)
+	tooManyEntries := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint16(tooManyEntries[8:], 500)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"orientation after another tag", jpegWith(exifSegment(tiffIFD(binary.LittleEndian, tiffEntry{tag: 0x010F, typ: 2}, orientationEntry(3)))), 3},
+		{"not a JPEG", concat([]byte{0x89, 'P', 'N', 'G'}, valid), 1},
+		{"empty", nil, 1},
+		{"no EXIF", jpegWith(jpegSegment(0xE0, []byte("JFIF\x00"))), 1},
+		{"APP1 that isn't EXIF", jpegWith(jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00"))), 1},
+		{"EXIF after the image data", jpegWith(jpegSegment(0xDA, []byte{0, 0}), exifSegment(valid)), 1},
+		{"segment length past the end", jpegWith(exifSegment(valid))[:20], 1},
+		{"segment length below 2", concat([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01}, exifSegment(valid)), 1},
+		{"IFD offset past the end", jpegWith(exifSegment(pastEnd)), 1},
+		{"IFD offset inside the header", jpegWith(exifSegment(concat([]byte("MM\x00\x2A\x00\x00\x00\x04"), valid[8:]))), 1},
+		{"more entries than data", jpegWith(exifSegment(tooManyEntries[:len(tooManyEntries)-16])), 1},
+		{"truncated TIFF header", jpegWith(exifSegment(valid[:6])), 1},
+		{"unknown byte order", jpegWith(exifSegment(concat([]byte("XX"), valid[2:]))), 1},
+		{"orientation of the wrong type", jpegWith(exifSegment(tiffIFD(binary.BigEndian, tiffEntry{tag: 0x0112, typ: 4, value: 6}))), 1},
+		{"orientation 0", jpegWith(exifSegment(tiffIFD(binary.BigEndian, orientationEntry(0)))), 1},
+		{"orientation 9", jpegWith(exifSegment(tiffIFD(binary.BigEndian, orientationEntry(9)))), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exifOrientation(tt.data); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// A 3x2 image with a distinct color in each corner
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	topLeft := color.NRGBA{R: 255, A: 255}
+	topRight := color.NRGBA{G: 255, A: 255}
+	bottomLeft := color.NRGBA{B: 255, A: 255}
+	src.Set(0, 0, topLeft)
+	src.Set(2, 0, topRight)
+	src.Set(0, 1, bottomLeft)
+
+	// Where each corner of the stored image ends up once turned upright
+	type point struct{ x, y int }
+	tests := []struct {
+		orientation                   int
+		width, height                 int
+		topLeft, topRight, bottomLeft point
+	}{
+		{1, 3, 2, point{0, 0}, point{2, 0}, point{0, 1}},
+		{2, 3, 2, point{2, 0}, point{0, 0}, point{2, 1}},
+		{3, 3, 2, point{2, 1}, point{0, 1}, point{2, 0}},
+		{4, 3, 2, point{0, 1}, point{2, 1}, point{0, 0}},
+		{5, 2, 3, point{0, 0}, point{0, 2}, point{1, 0}},
+		{6, 2, 3, point{1, 0}, point{1, 2}, point{0, 0}},
+		{7, 2, 3, point{1, 2}, point{1, 0}, point{0, 2}},
+		{8, 2, 3, point{0, 2}, point{0, 0}, point{1, 2}},
+	}
+	for _, tt := range tests {
+		dst := applyOrientation(src, tt.orientation)
+		if b := dst.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+			t.Errorf("orientation %d: got %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.width, tt.height)
+			continue
+		}
+		for _, corner := range []struct {
+			name string
+			at   point
+			want color.NRGBA
+		}{
+			{"top left", tt.topLeft, topLeft},
+			{"top right", tt.topRight, topRight},
+			{"bottom left", tt.bottomLeft, bottomLeft},
+		} {
+			if got := color.NRGBAModel.Convert(dst.At(corner.at.x, corner.at.y)); got != corner.want {
+				t.Errorf("orientation %d: %s corner at %v is %v, want %v", tt.orientation, corner.name, corner.at, got, corner.want)
+			}
+		}
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"My Photo.JPG", "my-photo"},
+		{`C:\Users\me\Holiday Pics.png`, "holiday-pics"},
+		{"../../etc/passwd", "passwd"},
+		{"photo.tar.gz", "photo-tar"},
+		{"---a___b---.gif", "a-b"},
+		{"café.png", "caf"},
+		{"日本語.png", "image"},
+		{".jpg", "image"},
+		{"/", "image"},
+		{"", "image"},
+		{strings.Repeat("a", 100) + ".png", strings.Repeat("a", 64)},
+		{strings.Repeat("a", 63) + " b.png", strings.Repeat("a", 63)},
+	}
+	for _, tt := range tests {
+		if got := SanitizeFilename(tt.name); got != tt.want {
+			t.Errorf("SanitizeFilename(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
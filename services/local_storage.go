@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStoragePath is the route the API serves local storage files under
+const LocalStoragePath = "/files"
+
+var (
+	// ErrUploadNotAllowed is returned for an upload with a bad or expired token
+	ErrUploadNotAllowed = errors.New("upload URL is invalid or has expired")
+	// ErrUploadMismatch is returned when an upload isn't the size or type
+	// its URL was issued for
+	ErrUploadMismatch = errors.New("upload does not match its URL")
+)
+
+// LocalStorage keeps files on this machine's disk and has the API serve them,
+// so development works without S3. Files don't survive a redeploy on hosts with
+// ephemeral disks, and aren't shared between replicas.
+type LocalStorage struct {
+	dir     string
+	baseURL string // public address of LocalStoragePath
+	signer  *Signer
+}
+
+// NewLocalStorage stores files under LOCAL_STORAGE_DIR (default ./uploads).
+// URLs start with LOCAL_STORAGE_URL, which defaults to this server on localhost.
+func NewLocalStorage() (*LocalStorage, error) {
+	dir := os.Getenv("LOCAL_STORAGE_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOCAL_STORAGE_DIR: %v", err)
+	}
+	for _, sub := range []string{"public", "private"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %v", err)
+		}
+	}
+
+	baseURL := os.Getenv("LOCAL_STORAGE_URL")
+	if baseURL == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		baseURL = "http://localhost:" + port + LocalStoragePath
+	}
+
+	signer, err := NewSignerFromEnv("STORAGE_URL_SECRET")
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalStorage{dir: dir, baseURL: baseURL, signer: signer}, nil
+}
+
+func (s *LocalStorage) PutPublic(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	return s.put(key, body, size, "public")
+}
+
+// PutPrivate stores a file that is only served through SignedURL
+func (s *LocalStorage) PutPrivate(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	return s.put(key, body, size, "private")
+}
+
+// put writes to a temporary file first, so a file is never served half-written.
+// It returns ErrUploadMismatch if body isn't size bytes.
+func (s *LocalStorage) put(key string, body io.Reader, size int64, visibility string) error {
+	path, err := s.path(visibility, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create storage directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to store file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, io.LimitReader(body, size+1))
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to store file: %v", err)
+	}
+	if written != size {
+		tmp.Close()
+		return ErrUploadMismatch
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to store file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store file: %v", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	for _, visibility := range []string{"public", "private"} {
+		path, err := s.path(visibility, key)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete file: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *LocalStorage) PublicURL(key string) string {
+	return joinKeyURL(s.baseURL, key)
+}
+
+// SignedURL links to a file with a token naming it and its expiry
+func (s *LocalStorage) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	return s.PublicURL(key) + "?token=" + url.QueryEscape(s.signer.Sign(expires+":"+key)), nil
+}
+
+// PresignUpload links to a PUT of the file with a token naming it, its size,
+// content type and expiry, for AcceptUpload to check
+func (s *LocalStorage) PresignUpload(ctx context.Context, key, contentType string, size int64, expiry time.Duration) (PresignedUpload, error) {
+	if _, err := s.path("private", key); err != nil {
+		return PresignedUpload{}, err
+	}
+	payload := strings.Join([]string{
+		"put", strconv.FormatInt(time.Now().Add(expiry).Unix(), 10), strconv.FormatInt(size, 10), contentType, key,
+	}, "|")
+	return PresignedUpload{
+		Method:  http.MethodPut,
+		URL:     s.PublicURL(key) + "?token=" + url.QueryEscape(s.signer.Sign(payload)),
+		Headers: map[string]string{"Content-Type": contentType},
+	}, nil
+}
+
+// AcceptUpload stores the body of a PUT to a PresignUpload URL privately,
+// after checking it against what the URL was issued for
+func (s *LocalStorage) AcceptUpload(key, token, contentType string, body io.Reader) error {
+	payload, ok := s.signer.Verify(token)
+	fields := strings.SplitN(payload, "|", 5)
+	if !ok || len(fields) != 5 || fields[0] != "put" || fields[4] != key {
+		return ErrUploadNotAllowed
+	}
+	expires, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrUploadNotAllowed
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return ErrUploadNotAllowed
+	}
+	if contentType != fields[3] {
+		return ErrUploadMismatch
+	}
+	return s.put(key, body, size, "private")
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	path, err := s.find(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to read file: %v", err)
+	}
+	return ObjectInfo{Size: info.Size()}, nil
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.find(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return file, nil
+}
+
+// find locates a stored file, public or private
+func (s *LocalStorage) find(key string, visibilities ...string) (string, error) {
+	if len(visibilities) == 0 {
+		visibilities = []string{"public", "private"}
+	}
+	for _, visibility := range visibilities {
+		path, err := s.path(visibility, key)
+		if err != nil {
+			return "", err
+		}
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, nil
+		}
+	}
+	return "", ErrObjectNotFound
+}
+
+// File finds a stored file for serving. Without a token only public files are
+// found; with one, any file the token was issued for until it expires.
+func (s *LocalStorage) File(key, token string) (string, bool) {
+	visibilities := []string{"public"}
+	if token != "" {
+		payload, ok := s.signer.Verify(token)
+		if !ok {
+			return "", false
+		}
+		expires, signedKey, _ := strings.Cut(payload, ":")
+		unix, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil || signedKey != key || time.Now().Unix() > unix {
+			return "", false
+		}
+		visibilities = append(visibilities, "private")
+	}
+
+	path, err := s.find(key, visibilities...)
+	return path, err == nil
+}
+
+// path maps a key to a file, refusing keys that would escape the directory
+func (s *LocalStorage) path(visibility, key string) (string, error) {
+	name := filepath.FromSlash(key)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("invalid storage key: %q", key)
+	}
+	return filepath.Join(s.dir, visibility, name), nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Mailer sends plain-text email through an SMTP server. In development point it
+// at a local catcher such as Mailpit or MailHog (SMTP_HOST=localhost, SMTP_PORT=1025).
+type Mailer struct {
+	addr         string
+	host         string
+	from         string // From header, may include a display name
+	envelopeFrom string // bare address for the SMTP MAIL command
+	username     string
+	password     string
+}
+
+func NewMailer() (*Mailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil, fmt.Errorf("SMTP_HOST environment variable not set")
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		return nil, fmt.Errorf("SMTP_FROM environment variable not set")
+	}
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_FROM address: %v", err)
+	}
+
+	return &Mailer{
+		addr:         net.JoinHostPort(host, port),
+		host:         host,
+		from:         fromAddr.String(),
+		envelopeFrom: fromAddr.Address,
+		username:     os.Getenv("SMTP_USERNAME"),
+		password:     os.Getenv("SMTP_PASSWORD"),
+	}, nil
+}
+
+func (m *Mailer) Send(to, subject, body string) error {
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient address")
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("utf-8", stripHeaderBreaks(subject)),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: 8bit",
+		"",
+		strings.ReplaceAll(body, "\n", "\r\n"),
+	}, "\r\n")
+
+	if err := smtp.SendMail(m.addr, auth, m.envelopeFrom, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	return nil
+}
+
+// stripHeaderBreaks stops user-supplied text from injecting extra headers
+func stripHeaderBreaks(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id parameters, following the OWASP recommendation of 64 MiB memory
+const (
+	argonMemory  = 64 * 1024
+	argonTime    = 3
+	argonThreads = 2
+	argonSaltLen = 16
+	argonKeyLen  = 32
+)
+
+// Limits on the parameters read back from a stored hash. argon2 panics below
+// the minimums, and the maximums stop a bad hash costing unbounded memory or time.
+const (
+	argonMaxMemory = 1024 * 1024 // 1 GiB
+	argonMaxTime   = 16
+	argonMinKeyLen = 16
+)
+
+// MinPasswordLength is the shortest password an admin account may have
+const MinPasswordLength = 12
+
+var errInvalidPasswordHash = errors.New("invalid password hash")
+
+// HashPassword returns an argon2id hash in the standard encoded form
+// "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>"
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %v", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// VerifyPassword checks a password against a hash from HashPassword. The
+// parameters are read from the hash so they can be raised later.
+func VerifyPassword(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, errInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errInvalidPasswordHash
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, errInvalidPasswordHash
+	}
+	if threads < 1 || iterations < 1 || iterations > argonMaxTime || memory > argonMaxMemory {
+		return false, errInvalidPasswordHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, errInvalidPasswordHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) < argonMinKeyLen {
+		return false, errInvalidPasswordHash
+	}
+
+	got := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// dummyPasswordHash is checked against when no account matches, so a login
+// for an unknown email takes as long as one with a wrong password
+var dummyPasswordHash, _ = HashPassword("not a real password")
+
+// SpendPasswordCheck does the work of a password check without an account
+func SpendPasswordCheck(password string) {
+	VerifyPassword(password, dummyPasswordHash)
+}
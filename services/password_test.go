@@ -0,0 +1,77 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Errorf("unexpected hash format %q", hash)
+	}
+
+	tests := []struct {
+		password string
+		match    bool
+	}{
+		{"correct horse battery staple", true},
+		{"correct horse battery stapl", false},
+		{"Correct horse battery staple", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		ok, err := VerifyPassword(tt.password, hash)
+		if err != nil {
+			t.Errorf("%q: %v", tt.password, err)
+		}
+		if ok != tt.match {
+			t.Errorf("%q: matched %v, want %v", tt.password, ok, tt.match)
+		}
+	}
+
+	other, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == hash {
+		t.Error("two hashes of the same password share a salt")
+	}
+}
+
+func TestVerifyPasswordRejectsMalformedHashes(t *testing.T) {
+	// A valid salt and key, with the parameters varied
+	const salt, key = "c2FsdHNhbHRzYWx0c2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"empty", ""},
+		{"bcrypt", "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"},
+		{"argon2i", "$argon2i$v=19$m=65536,t=3,p=2$" + salt + "$" + key},
+		{"too few parts", "$argon2id$v=19$m=65536,t=3,p=2$" + salt},
+		{"too many parts", "$argon2id$v=19$m=65536,t=3,p=2$" + salt + "$" + key + "$x"},
+		{"other version", "$argon2id$v=16$m=65536,t=3,p=2$" + salt + "$" + key},
+		{"garbled parameters", "$argon2id$v=19$m=a,t=3,p=2$" + salt + "$" + key},
+		{"no iterations", "$argon2id$v=19$m=65536,t=0,p=2$" + salt + "$" + key},
+		{"no threads", "$argon2id$v=19$m=65536,t=3,p=0$" + salt + "$" + key},
+		{"too many threads", "$argon2id$v=19$m=65536,t=3,p=256$" + salt + "$" + key},
+		{"too much memory", "$argon2id$v=19$m=4294967295,t=3,p=2$" + salt + "$" + key},
+		{"too many iterations", "$argon2id$v=19$m=65536,t=1000000,p=2$" + salt + "$" + key},
+		{"salt that isn't base64", "$argon2id$v=19$m=65536,t=3,p=2$!!!$" + key},
+		{"key that isn't base64", "$argon2id$v=19$m=65536,t=3,p=2$" + salt + "$!!!"},
+		{"empty key", "$argon2id$v=19$m=65536,t=3,p=2$" + salt + "$"},
+		{"short key", "$argon2id$v=19$m=65536,t=3,p=2$" + salt + "$a2V5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := VerifyPassword("password", tt.hash)
+			if ok || err != errInvalidPasswordHash {
+				t.Errorf("got %v, %v; want false, errInvalidPasswordHash", ok, err)
+			}
+		})
+	}
+}
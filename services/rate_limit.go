@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TokenBucket describes a token bucket: it holds up to Capacity tokens, refills
+// completely over Period, and each request takes one token
+type TokenBucket struct {
+	Capacity int
+	Period   time.Duration
+}
+
+// rate is the refill rate in tokens per second
+func (b TokenBucket) rate() float64 {
+	return float64(b.Capacity) / b.Period.Seconds()
+}
+
+// RateLimitResult is the outcome of taking a token
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int           // whole tokens left
+	RetryAfter time.Duration // until the next token, when not allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// result works out a RateLimitResult from the tokens left after a request
+func (b TokenBucket) result(allowed bool, tokens float64) RateLimitResult {
+	rate := b.rate()
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(b.Capacity) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return result
+}
+
+// RateLimitStore keeps token buckets by key
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, bucket TokenBucket) (RateLimitResult, error)
+}
+
+// keyedRateLimitTimeout bounds a store lookup. Events are allowed if the store fails.
+const keyedRateLimitTimeout = time.Second
+
+// KeyedRateLimiter applies a named token bucket in a RateLimitStore to keys the
+// caller picks, such as email addresses, where a limit isn't per request
+type KeyedRateLimiter struct {
+	store  RateLimitStore
+	name   string // keeps the limiter's buckets apart from others' in the store
+	bucket TokenBucket
+}
+
+func NewKeyedRateLimiter(store RateLimitStore, name string, bucket TokenBucket) *KeyedRateLimiter {
+	return &KeyedRateLimiter{store: store, name: name, bucket: bucket}
+}
+
+// Allow takes a token for key, reporting how long to wait if there are none left
+func (l *KeyedRateLimiter) Allow(key string) (bool, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyedRateLimitTimeout)
+	defer cancel()
+
+	result, err := l.store.Take(ctx, l.name+":"+key, l.bucket)
+	if err != nil {
+		log.Printf("Rate limit store failed, allowing %s: %v", l.name, err)
+		return true, 0
+	}
+	return result.Allowed, result.RetryAfter
+}
+
+// MemoryRateLimitStore keeps buckets in this process. Each replica counts
+// separately.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	fullAt  time.Time
+}
+
+// memorySweepInterval is how often full buckets are dropped
+const memorySweepInterval = time.Minute
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*memoryBucket)}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, bucket TokenBucket) (RateLimitResult, error) {
+	return s.take(key, bucket, time.Now()), nil
+}
+
+func (s *MemoryRateLimitStore) take(key string, bucket TokenBucket, now time.Time) RateLimitResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A full bucket is the same as no bucket, so drop them to bound the map
+	if now.Sub(s.lastSweep) >= memorySweepInterval {
+		for k, b := range s.buckets {
+			if !now.Before(b.fullAt) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	capacity := float64(bucket.Capacity)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*bucket.rate())
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.fullAt = now.Add(time.Duration((capacity - b.tokens) / bucket.rate() * float64(time.Second)))
+	return bucket.result(allowed, b.tokens)
+}
+
+// PostgresRateLimitStore keeps buckets in the rate_limit_buckets table so
+// limits hold across replicas. Each request is one upsert.
+type PostgresRateLimitStore struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresRateLimitStore(db *pgxpool.Pool) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db}
+}
+
+// refilledTokensSQL is a bucket's tokens after refilling since its last
+// update, with $2 the capacity and $3 the refill rate per second
+const refilledTokensSQL = `LEAST($2::float8, b.tokens +
+	EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') - b.updated_at) * $3::float8)`
+
+func (s *PostgresRateLimitStore) Take(ctx context.Context, key string, bucket TokenBucket) (RateLimitResult, error) {
+	var tokens float64
+	var allowed bool
+	err := s.db.QueryRow(
+		ctx,
+		`INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at, full_at)
+		VALUES ($1, $2::float8 - 1, true, (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'),
+			(CURRENT_TIMESTAMP AT TIME ZONE 'UTC') + make_interval(secs => 1 / $3::float8))
+		ON CONFLICT (key) DO UPDATE SET
+			allowed = `+refilledTokensSQL+` >= 1,
+			tokens = CASE WHEN `+refilledTokensSQL+` >= 1 THEN `+refilledTokensSQL+` - 1 ELSE `+refilledTokensSQL+` END,
+			updated_at = (CURRENT_TIMESTAMP AT TIME ZONE 'UTC'),
+			full_at = (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') + make_interval(secs =>
+				($2::float8 - CASE WHEN `+refilledTokensSQL+` >= 1 THEN `+refilledTokensSQL+` - 1 ELSE `+refilledTokensSQL+` END) / $3::float8)
+		RETURNING tokens, allowed`,
+		key, bucket.Capacity, bucket.rate(),
+	).Scan(&tokens, &allowed)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return bucket.result(allowed, tokens), nil
+}
+
+// DeleteFullBuckets removes buckets that have refilled, which behave the same
+// as missing ones
+func (s *PostgresRateLimitStore) DeleteFullBuckets(ctx context.Context) (int64, error) {
+	result, err := s.db.Exec(ctx, "DELETE FROM rate_limit_buckets WHERE full_at <= (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStoreTokenBucket(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	bucket := TokenBucket{Capacity: 3, Period: 3 * time.Second} // a token a second
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name       string
+		after      time.Duration // since start
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+		reset      time.Duration
+	}{
+		{"first request", 0, true, 2, 0, time.Second},
+		{"second request", 0, true, 1, 0, 2 * time.Second},
+		{"third request", 0, true, 0, 0, 3 * time.Second},
+		{"bucket empty", 0, false, 0, time.Second, 3 * time.Second},
+		{"half a token back", 500 * time.Millisecond, false, 0, 500 * time.Millisecond, 2500 * time.Millisecond},
+		{"a token back", time.Second, true, 0, 0, 3 * time.Second},
+		{"refilled past capacity", time.Minute, true, 2, 0, time.Second},
+	}
+	for _, step := range steps {
+		result := store.take("client", bucket, start.Add(step.after))
+		if result.Allowed != step.allowed || result.Remaining != step.remaining {
+			t.Errorf("%s: got allowed %v with %d remaining, want %v with %d",
+				step.name, result.Allowed, result.Remaining, step.allowed, step.remaining)
+		}
+		if result.RetryAfter != step.retryAfter {
+			t.Errorf("%s: got retry after %s, want %s", step.name, result.RetryAfter, step.retryAfter)
+		}
+		if result.Reset != step.reset {
+			t.Errorf("%s: got reset %s, want %s", step.name, result.Reset, step.reset)
+		}
+	}
+}
+
+func TestMemoryRateLimitStoreKeepsKeysApart(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	bucket := TokenBucket{Capacity: 1, Period: time.Hour}
+	now := time.Now()
+
+	if !store.take("a", bucket, now).Allowed {
+		t.Fatal("first request for a refused")
+	}
+	if store.take("a", bucket, now).Allowed {
+		t.Error("second request for a allowed")
+	}
+	if !store.take("b", bucket, now).Allowed {
+		t.Error("b was limited by a's requests")
+	}
+}
+
+func TestMemoryRateLimitStoreDropsFullBuckets(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	bucket := TokenBucket{Capacity: 2, Period: time.Minute}
+	start := time.Now()
+	sweep := start.Add(memorySweepInterval)
+
+	store.take("idle", bucket, start)
+	store.take("busy", bucket, sweep.Add(-time.Second))
+	store.take("busy", bucket, sweep.Add(-time.Second))
+
+	// The next request sweeps: idle has refilled by then, busy hasn't
+	store.take("other", bucket, sweep)
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("full bucket was not dropped")
+	}
+	if _, ok := store.buckets["busy"]; !ok {
+		t.Fatal("bucket in use was dropped")
+	}
+	if result := store.take("busy", bucket, sweep); result.Allowed {
+		t.Errorf("busy bucket was reset: %+v", result)
+	}
+}
+
+// recordingStore remembers the keys taken from it, and fails if err is set
+type recordingStore struct {
+	keys []string
+	err  error
+}
+
+func (s *recordingStore) Take(ctx context.Context, key string, bucket TokenBucket) (RateLimitResult, error) {
+	s.keys = append(s.keys, key)
+	if s.err != nil {
+		return RateLimitResult{}, s.err
+	}
+	return RateLimitResult{Allowed: false, RetryAfter: time.Minute}, nil
+}
+
+func TestKeyedRateLimiter(t *testing.T) {
+	store := &recordingStore{}
+	limiter := NewKeyedRateLimiter(store, "comment-emails", TokenBucket{Capacity: 1, Period: time.Hour})
+
+	allowed, retryAfter := limiter.Allow("someone@example.com")
+	if allowed || retryAfter != time.Minute {
+		t.Errorf("got %v, %s; want the store's answer", allowed, retryAfter)
+	}
+	if len(store.keys) != 1 || store.keys[0] != "comment-emails:someone@example.com" {
+		t.Errorf("took %v, want the key under the limiter's name", store.keys)
+	}
+
+	// Events are let through when the store can't be reached
+	store.err = errors.New("connection refused")
+	if allowed, _ := limiter.Allow("someone@example.com"); !allowed {
+		t.Error("refused when the store failed")
+	}
+}
@@ -1,32 +1,31 @@
 package services
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
 	"io"
-	"log"
-	"mime/multipart"
+	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/google/uuid"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-type S3Service struct {
-	client *s3.Client
-	bucket string
+// S3Storage keeps files in an S3 bucket, on AWS or any S3-compatible service
+// such as MinIO (S3_ENDPOINT, usually with S3_FORCE_PATH_STYLE=true)
+type S3Storage struct {
+	client    *s3.Client
+	bucket    string
+	publicURL string // base URL of public objects
 }
 
-func NewS3Service() (*S3Service, error) {
+func NewS3Storage() (*S3Storage, error) {
 	region := os.Getenv("AWS_REGION")
 	if region == "" {
 		region = "us-east-1" // default region
@@ -42,66 +41,81 @@ func NewS3Service() (*S3Service, error) {
 		return nil, fmt.Errorf("S3_BUCKET_NAME environment variable not set")
 	}
 
-	client := s3.NewFromConfig(cfg)
+	endpoint := os.Getenv("S3_ENDPOINT")
+	pathStyle := os.Getenv("S3_FORCE_PATH_STYLE") == "true"
 
-	return &S3Service{
-		client: client,
-		bucket: bucket,
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.UsePathStyle = pathStyle
+	})
+
+	publicURL := os.Getenv("S3_PUBLIC_URL")
+	if publicURL == "" {
+		publicURL, err = defaultS3PublicURL(endpoint, bucket, region, pathStyle)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &S3Storage{
+		client:    client,
+		bucket:    bucket,
+		publicURL: publicURL,
 	}, nil
 }
 
-func (s *S3Service) UploadImage(file multipart.File, fileSize int64, originalFilename string) (string, string, error) {
-	// Validate file type
-	ext := strings.ToLower(filepath.Ext(originalFilename))
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".gif" {
-		return "", "", fmt.Errorf("invalid file type: %s", ext)
+// defaultS3PublicURL is where the bucket's objects are served when no
+// S3_PUBLIC_URL (such as a CDN) is set
+func defaultS3PublicURL(endpoint, bucket, region string, pathStyle bool) (string, error) {
+	if endpoint == "" {
+		if pathStyle {
+			return fmt.Sprintf("https://s3.%s.amazonaws.com/%s", region, bucket), nil
+		}
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region), nil
 	}
 
-	// Validate file size (5MB limit)
-	if fileSize > 5*1024*1024 {
-		return "", "", fmt.Errorf("file too large: maximum 5MB allowed")
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid S3_ENDPOINT %q", endpoint)
 	}
-
-	// Generate a unique filename
-	fileID := uuid.New().String()
-	fileName := fmt.Sprintf("blogs/%s_%s", fileID, originalFilename)
-
-	// Read the file content
-	fileBytes, err := io.ReadAll(file)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to read file: %v", err)
+	if pathStyle {
+		return joinKeyURL(endpoint, bucket), nil
 	}
+	u.Host = bucket + "." + u.Host
+	return u.String(), nil
+}
 
-	// Optimize image if needed (for JPEG and PNG)
-	fileBuffer := bytes.NewReader(fileBytes)
-	optimizedBytes, err := s.optimizeImage(fileBuffer, ext)
-	if err != nil {
-		// If optimization fails, use the original bytes
-		log.Printf("Image optimization failed: %v, using original", err)
-		optimizedBytes = fileBytes
-	}
+func (s *S3Storage) PutPublic(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	return s.put(ctx, key, body, size, contentType, types.ObjectCannedACLPublicRead)
+}
+
+// PutPrivate stores a file without public access. Private objects are only
+// reachable through SignedURL.
+func (s *S3Storage) PutPrivate(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	return s.put(ctx, key, body, size, contentType, types.ObjectCannedACLPrivate)
+}
 
-	// Upload to S3
-	_, err = s.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(fileName),
-		Body:        bytes.NewReader(optimizedBytes),
-		ContentType: aws.String(getContentType(ext)),
-		ACL:         "public-read", // Make the image publicly accessible
+func (s *S3Storage) put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string, acl types.ObjectCannedACL) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType),
+		ACL:           acl,
 	})
 
 	if err != nil {
-		return "", "", fmt.Errorf("failed to upload to S3: %v", err)
+		return fmt.Errorf("failed to upload to S3: %v", err)
 	}
 
-	// Generate public URL
-	publicURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, os.Getenv("AWS_REGION"), fileName)
-
-	return fileName, publicURL, nil
+	return nil
 }
 
-func (s *S3Service) DeleteImage(key string) error {
-	_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
@@ -113,12 +127,16 @@ func (s *S3Service) DeleteImage(key string) error {
 	return nil
 }
 
-func (s *S3Service) GetPresignedURL(key string, duration time.Duration) (string, error) {
+func (s *S3Storage) PublicURL(key string) string {
+	return joinKeyURL(s.publicURL, key)
+}
+
+func (s *S3Storage) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
 	presignClient := s3.NewPresignClient(s.client)
-	presignResult, err := presignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+	presignResult, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
-	}, s3.WithPresignExpires(duration))
+	}, s3.WithPresignExpires(expiry))
 
 	if err != nil {
 		return "", fmt.Errorf("failed to generate presigned URL: %v", err)
@@ -127,52 +145,63 @@ func (s *S3Service) GetPresignedURL(key string, duration time.Duration) (string,
 	return presignResult.URL, nil
 }
 
-func getContentType(ext string) string {
-	switch ext {
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".png":
-		return "image/png"
-	case ".gif":
-		return "image/gif"
-	default:
-		return "image/jpeg" // default to jpeg
+// PresignUpload signs a PUT with the size and content type, so S3 refuses any
+// other file. Objects uploaded this way are private.
+func (s *S3Storage) PresignUpload(ctx context.Context, key, contentType string, size int64, expiry time.Duration) (PresignedUpload, error) {
+	presignClient := s3.NewPresignClient(s.client)
+	presignResult, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(expiry))
+
+	if err != nil {
+		return PresignedUpload{}, fmt.Errorf("failed to generate presigned upload: %v", err)
 	}
-}
 
-func (s *S3Service) optimizeImage(reader io.Reader, ext string) ([]byte, error) {
-	var img image.Image
-	var err error
-
-	switch ext {
-	case ".jpg", ".jpeg":
-		img, err = jpeg.Decode(reader)
-	case ".png":
-		img, err = png.Decode(reader)
-	default:
-		// For unsupported formats, return original
-		return nil, fmt.Errorf("unsupported image format for optimization: %s", ext)
+	// Clients set Host and Content-Length themselves
+	headers := make(map[string]string)
+	for name := range presignResult.SignedHeader {
+		if name != "Host" && name != "Content-Length" {
+			headers[name] = presignResult.SignedHeader.Get(name)
+		}
 	}
 
+	return PresignedUpload{Method: presignResult.Method, URL: presignResult.URL, Headers: headers}, nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	result, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %v", err)
+		var notFound *types.NotFound
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &notFound) || (errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound) {
+			return ObjectInfo{}, ErrObjectNotFound
+		}
+		return ObjectInfo{}, fmt.Errorf("failed to read from S3: %v", err)
 	}
 
-	// Create a buffer to write the optimized image
-	var buf bytes.Buffer
+	return ObjectInfo{Size: aws.ToInt64(result.ContentLength), ContentType: aws.ToString(result.ContentType)}, nil
+}
 
-	// Encode with quality settings
-	switch ext {
-	case ".jpg", ".jpeg":
-		options := &jpeg.Options{Quality: 80} // 80% quality
-		err = jpeg.Encode(&buf, img, options)
-	case ".png":
-		err = png.Encode(&buf, img) // PNG is lossless but we can optimize it differently if needed
-	}
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to encode optimized image: %v", err)
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to read from S3: %v", err)
 	}
 
-	return buf.Bytes(), nil
-}
\ No newline at end of file
+	return result.Body, nil
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// NewToken returns a random 256-bit token, hex encoded
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken is how session tokens are stored, so a database leak doesn't expose live sessions
+func HashToken(token string) string {
+	return HashAPIKey(token)
+}
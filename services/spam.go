@@ -0,0 +1,323 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SpamSubmission is the part of a public submission the spam checks look at
+type SpamSubmission struct {
+	IP          string
+	Email       string
+	Name        string
+	Content     string
+	Honeypot    string // hidden field real visitors never fill in
+	Token       string // issued by SpamTokenIssuer when the page was loaded
+	ProofOfWork string // nonce solving the token's proof-of-work challenge
+}
+
+// SpamVerdict is the combined score of every check
+type SpamVerdict struct {
+	Score   float64
+	Reasons []string
+	IsSpam  bool
+}
+
+// SpamRejection is returned when a check refuses a submission outright rather
+// than scoring it. RetryAfter is set when the client was rate limited.
+type SpamRejection struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *SpamRejection) Error() string {
+	return e.Message
+}
+
+// SpamCheck scores a submission. Checks return a *SpamRejection to refuse it.
+type SpamCheck interface {
+	Check(sub SpamSubmission) (score float64, reason string, err error)
+}
+
+// SpamFilter runs a pipeline of checks and flags submissions whose total score
+// reaches the threshold
+type SpamFilter struct {
+	threshold float64
+	checks    []SpamCheck
+}
+
+func NewSpamFilter(threshold float64, checks ...SpamCheck) *SpamFilter {
+	return &SpamFilter{
+		threshold: threshold,
+		checks:    checks,
+	}
+}
+
+// Evaluate runs every check. A nil filter lets everything through.
+func (f *SpamFilter) Evaluate(sub SpamSubmission) (SpamVerdict, error) {
+	var verdict SpamVerdict
+	if f == nil {
+		return verdict, nil
+	}
+
+	for _, check := range f.checks {
+		score, reason, err := check.Check(sub)
+		if err != nil {
+			return verdict, err
+		}
+		if score > 0 {
+			verdict.Score += score
+			verdict.Reasons = append(verdict.Reasons, reason)
+		}
+	}
+
+	verdict.IsSpam = verdict.Score >= f.threshold
+	return verdict, nil
+}
+
+// HoneypotCheck flags submissions that filled in the hidden honeypot field
+type HoneypotCheck struct {
+	Score float64
+}
+
+func (h HoneypotCheck) Check(sub SpamSubmission) (float64, string, error) {
+	if strings.TrimSpace(sub.Honeypot) != "" {
+		return h.Score, "honeypot field filled in", nil
+	}
+	return 0, "", nil
+}
+
+// SpamTokenIssuer signs the tokens clients fetch before showing a form. A token
+// records when it was issued and doubles as the proof-of-work challenge.
+type SpamTokenIssuer struct {
+	signer     *Signer
+	difficulty int // leading zero bits required by the proof of work; 0 disables it
+}
+
+// NewSpamTokenIssuer reads SPAM_TOKEN_SECRET and SPAM_POW_DIFFICULTY
+func NewSpamTokenIssuer() (*SpamTokenIssuer, error) {
+	signer, err := NewSignerFromEnv("SPAM_TOKEN_SECRET")
+	if err != nil {
+		return nil, err
+	}
+
+	difficulty := 0
+	if value := os.Getenv("SPAM_POW_DIFFICULTY"); value != "" {
+		d, err := strconv.Atoi(value)
+		if err != nil || d < 0 || d > 32 {
+			return nil, fmt.Errorf("SPAM_POW_DIFFICULTY must be between 0 and 32")
+		}
+		difficulty = d
+	}
+
+	return &SpamTokenIssuer{signer: signer, difficulty: difficulty}, nil
+}
+
+// Difficulty is the number of leading zero bits the proof of work must have
+func (t *SpamTokenIssuer) Difficulty() int {
+	return t.difficulty
+}
+
+// Issue returns a new signed token in the form "<unix time>.<nonce>.<signature>"
+func (t *SpamTokenIssuer) Issue() (string, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return t.signer.Sign(strconv.FormatInt(time.Now().Unix(), 10) + "." + hex.EncodeToString(nonce)), nil
+}
+
+// issuedAt verifies a token's signature and returns when it was issued
+func (t *SpamTokenIssuer) issuedAt(token string) (time.Time, bool) {
+	payload, ok := t.signer.Verify(token)
+	if !ok {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(strings.SplitN(payload, ".", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+// TimingCheck scores submissions made implausibly soon after the token was
+// issued, or without a valid token at all
+type TimingCheck struct {
+	tokens       *SpamTokenIssuer
+	minDuration  time.Duration
+	maxAge       time.Duration
+	tooFastScore float64
+	invalidScore float64
+}
+
+func NewTimingCheck(tokens *SpamTokenIssuer, minDuration, maxAge time.Duration, tooFastScore, invalidScore float64) *TimingCheck {
+	return &TimingCheck{
+		tokens:       tokens,
+		minDuration:  minDuration,
+		maxAge:       maxAge,
+		tooFastScore: tooFastScore,
+		invalidScore: invalidScore,
+	}
+}
+
+func (tc *TimingCheck) Check(sub SpamSubmission) (float64, string, error) {
+	if sub.Token == "" {
+		return tc.invalidScore, "missing submission token", nil
+	}
+	issued, ok := tc.tokens.issuedAt(sub.Token)
+	if !ok {
+		return tc.invalidScore, "invalid submission token", nil
+	}
+	elapsed := time.Since(issued)
+	if elapsed > tc.maxAge {
+		return tc.invalidScore, "expired submission token", nil
+	}
+	if elapsed < tc.minDuration {
+		return tc.tooFastScore, fmt.Sprintf("submitted %s after loading", elapsed.Round(time.Millisecond)), nil
+	}
+	return 0, "", nil
+}
+
+// ProofOfWorkCheck requires sha256(token + ":" + nonce) to start with the
+// issuer's number of zero bits. Each token can only be spent once: spent takes
+// a token's one use, and should refill no sooner than the token expires.
+type ProofOfWorkCheck struct {
+	tokens *SpamTokenIssuer
+	maxAge time.Duration
+	spent  RateLimiter
+}
+
+func NewProofOfWorkCheck(tokens *SpamTokenIssuer, maxAge time.Duration, spent RateLimiter) *ProofOfWorkCheck {
+	return &ProofOfWorkCheck{
+		tokens: tokens,
+		maxAge: maxAge,
+		spent:  spent,
+	}
+}
+
+func (p *ProofOfWorkCheck) Check(sub SpamSubmission) (float64, string, error) {
+	if p.tokens.difficulty == 0 {
+		return 0, "", nil
+	}
+
+	issued, ok := p.tokens.issuedAt(sub.Token)
+	if !ok || time.Since(issued) > p.maxAge {
+		return 0, "", &SpamRejection{Message: "A valid submission token is required"}
+	}
+	sum := sha256.Sum256([]byte(sub.Token + ":" + sub.ProofOfWork))
+	if leadingZeroBits(sum[:]) < p.tokens.difficulty {
+		return 0, "", &SpamRejection{Message: "Invalid proof of work"}
+	}
+
+	if allowed, _ := p.spent.Allow(sub.Token); !allowed {
+		return 0, "", &SpamRejection{Message: "Submission token already used"}
+	}
+
+	return 0, "", nil
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, v := range b {
+		if v != 0 {
+			return n + bits.LeadingZeros8(v)
+		}
+		n += 8
+	}
+	return n
+}
+
+// RateLimiter allows a number of events per key, reporting how long to wait when denied
+type RateLimiter interface {
+	Allow(key string) (bool, time.Duration)
+}
+
+// RateLimitCheck refuses submissions once a client IP or email address has
+// submitted too often. Either limiter may be nil.
+type RateLimitCheck struct {
+	ipLimiter    RateLimiter
+	emailLimiter RateLimiter
+}
+
+func NewRateLimitCheck(ipLimiter, emailLimiter RateLimiter) *RateLimitCheck {
+	return &RateLimitCheck{
+		ipLimiter:    ipLimiter,
+		emailLimiter: emailLimiter,
+	}
+}
+
+func (r *RateLimitCheck) Check(sub SpamSubmission) (float64, string, error) {
+	if r.ipLimiter != nil && sub.IP != "" {
+		if ok, retryAfter := r.ipLimiter.Allow(sub.IP); !ok {
+			return 0, "", &SpamRejection{Message: "Too many submissions, please try again later", RetryAfter: retryAfter}
+		}
+	}
+	if r.emailLimiter != nil && sub.Email != "" {
+		if ok, retryAfter := r.emailLimiter.Allow(strings.ToLower(sub.Email)); !ok {
+			return 0, "", &SpamRejection{Message: "Too many submissions from this email address, please try again later", RetryAfter: retryAfter}
+		}
+	}
+	return 0, "", nil
+}
+
+var spamURLPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// DefaultSpamKeywords are phrases that rarely appear in genuine comments
+var DefaultSpamKeywords = []string{
+	"viagra", "cialis", "casino", "porn", "payday loan", "forex", "crypto investment",
+	"bitcoin investment", "seo services", "backlinks", "buy followers", "work from home",
+	"click here", "earn money fast",
+}
+
+// ContentHeuristicCheck scores spam keywords and link-heavy content
+type ContentHeuristicCheck struct {
+	keywords     []string
+	maxURLs      int
+	keywordScore float64
+	urlScore     float64
+}
+
+func NewContentHeuristicCheck(keywords []string, maxURLs int, keywordScore, urlScore float64) *ContentHeuristicCheck {
+	lowered := make([]string, len(keywords))
+	for i, k := range keywords {
+		lowered[i] = strings.ToLower(k)
+	}
+	return &ContentHeuristicCheck{
+		keywords:     lowered,
+		maxURLs:      maxURLs,
+		keywordScore: keywordScore,
+		urlScore:     urlScore,
+	}
+}
+
+func (h *ContentHeuristicCheck) Check(sub SpamSubmission) (float64, string, error) {
+	var score float64
+	var reasons []string
+
+	text := strings.ToLower(sub.Name + " " + sub.Content)
+	for _, keyword := range h.keywords {
+		if strings.Contains(text, keyword) {
+			score += h.keywordScore
+			reasons = append(reasons, "keyword "+strconv.Quote(keyword))
+		}
+	}
+
+	if urls := len(spamURLPattern.FindAllString(sub.Content, -1)); urls > h.maxURLs {
+		score += h.urlScore * float64(urls-h.maxURLs)
+		reasons = append(reasons, fmt.Sprintf("%d links", urls))
+	}
+	if spamURLPattern.MatchString(sub.Name) {
+		score += h.urlScore
+		reasons = append(reasons, "link in name")
+	}
+
+	return score, strings.Join(reasons, ", "), nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Storage keeps uploaded files. Public files can be fetched by anyone at their
+// PublicURL; private files only through a short-lived SignedURL.
+type Storage interface {
+	PutPublic(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error
+	PutPrivate(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error
+	Delete(ctx context.Context, key string) error
+	PublicURL(key string) string
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+
+	// PresignUpload lets a client store a private file under key itself, without
+	// it passing through the API. The file must be exactly size bytes of
+	// contentType, and the upload must start before expiry.
+	PresignUpload(ctx context.Context, key, contentType string, size int64, expiry time.Duration) (PresignedUpload, error)
+	// Stat returns ErrObjectNotFound if nothing is stored under key
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// PresignedUpload is the request a client makes to upload a file directly
+type PresignedUpload struct {
+	Method  string
+	URL     string
+	Headers map[string]string // to be sent as given
+}
+
+// ObjectInfo describes a stored file
+type ObjectInfo struct {
+	Size        int64
+	ContentType string // empty if the backend doesn't record it
+}
+
+var ErrObjectNotFound = errors.New("object not found")
+
+const (
+	StorageDriverS3    = "s3"
+	StorageDriverLocal = "local"
+)
+
+// StorageDriver is the storage backend selected by STORAGE_DRIVER. Without it,
+// S3 is used when S3_BUCKET_NAME is set and local disk otherwise.
+func StorageDriver() string {
+	if driver := os.Getenv("STORAGE_DRIVER"); driver != "" {
+		return driver
+	}
+	if os.Getenv("S3_BUCKET_NAME") != "" {
+		return StorageDriverS3
+	}
+	return StorageDriverLocal
+}
+
+// NewStorage sets up the storage backend selected by StorageDriver
+func NewStorage() (Storage, error) {
+	switch driver := StorageDriver(); driver {
+	case StorageDriverS3:
+		return NewS3Storage()
+	case StorageDriverLocal:
+		return NewLocalStorage()
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q, must be s3 or local", driver)
+	}
+}
+
+// joinKeyURL appends an object key to a base URL, escaping each path segment
+func joinKeyURL(base, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimRight(base, "/") + "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key from RFC 6238, "12345678901234567890"
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTPMatchesRFC6238(t *testing.T) {
+	// The RFC's 8 digit values, cut to their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, 0, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Errorf("at %d: code %s rejected", tt.unix, tt.code)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("at %d: matched step %d, want %d", tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name   string
+		step   int64
+		accept bool
+	}{
+		{"current period", current, true},
+		{"previous period", current - 1, true},
+		{"next period", current + 1, true},
+		{"two periods ago", current - 2, false},
+		{"two periods ahead", current + 2, false},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, totpCode(key, tt.step), 0, now)
+		if ok != tt.accept {
+			t.Errorf("%s: accepted %v, want %v", tt.name, ok, tt.accept)
+		}
+		if ok && step != tt.step {
+			t.Errorf("%s: matched step %d, want %d", tt.name, step, tt.step)
+		}
+	}
+}
+
+func TestValidateTOTPRejectsReplay(t *testing.T) {
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	code := totpCode(key, current)
+
+	step, ok := ValidateTOTP(rfc6238Secret, code, 0, now)
+	if !ok {
+		t.Fatal("first use rejected")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, code, step, now); ok {
+		t.Error("the same code was accepted twice")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, code, step, now.Add(totpPeriod*time.Second)); ok {
+		t.Error("the code was accepted again in the next period")
+	}
+
+	// An older code still inside the skew window can't be used after a newer one
+	if _, ok := ValidateTOTP(rfc6238Secret, totpCode(key, current-1), current, now); ok {
+		t.Error("a code older than the last one used was accepted")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, totpCode(key, current+1), current, now); !ok {
+		t.Error("a newer code was rejected after an older one was used")
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	now := time.Unix(1234567890, 0)
+	code := totpCode(key, now.Unix()/totpPeriod)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		accept bool
+	}{
+		{"spaces in the code", rfc6238Secret, code[:3] + " " + code[3:], true},
+		{"surrounding whitespace", " " + rfc6238Secret + "\n", " " + code + " ", true},
+		{"lowercase secret", strings.ToLower(rfc6238Secret), code, true},
+		{"empty code", rfc6238Secret, "", false},
+		{"short code", rfc6238Secret, code[:5], false},
+		{"long code", rfc6238Secret, code + "0", false},
+		{"wrong code", rfc6238Secret, "000000", code == "000000"},
+		{"secret that isn't base32", "not base32!", code, false},
+		{"padded secret", rfc6238Secret + "====", code, false},
+	}
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, 0, now); ok != tt.accept {
+			t.Errorf("%s: accepted %v, want %v", tt.name, ok, tt.accept)
+		}
+	}
+}
+
+func TestGenerateTOTPSecretRoundTrips(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+	now := time.Now()
+	if _, ok := ValidateTOTP(secret, totpCode(key, now.Unix()/totpPeriod), 0, now); !ok {
+		t.Error("code for a generated secret rejected")
+	}
+}